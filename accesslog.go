@@ -0,0 +1,246 @@
+package mylib
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Apache style access log formats, used when AccessLogFormat is "common" or "combined"
+const (
+	AccessLogCommon   = `%h %l %u %t "%r" %>s %b`
+	AccessLogCombined = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+)
+
+type accessLogEntry struct {
+	r       *http.Request
+	w       *accessLogWriter
+	start   time.Time
+	elapsed time.Duration
+}
+
+type accessLogToken func(e *accessLogEntry) string
+
+// accessLogWriter records the status and size of a response
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Used by http.ResponseController to reach the original writer
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// AccessLog middleware, writes one line per request into LogPath/<logName>/YYYYMMDD.log
+// with the same rotation as SetUpLog
+// AccessLogFormat : "common" (default), "combined" or a template of Apache tokens :
+// %h %a remote ip, %l '-', %u basic auth user, %t time ( AccessLogTimeFormat ), %r request line,
+// %m method, %U path, %q query string, %H protocol, %s %>s status, %b %B response bytes,
+// %D latency in microsecond, %T latency in second, %{ms}T latency in milisecond,
+// %{Header}i request header, %{Header}o response header, %% percent sign
+// param :
+// 1. @logName ( e.g. "access" ) -> string
+// 2. @next -> http.Handler
+func (l *Utils) AccessLog(logName string, next http.Handler) http.Handler {
+
+	format := l.AccessLogFormat
+	if format == "" || format == "common" {
+		format = AccessLogCommon
+	} else if format == "combined" {
+		format = AccessLogCombined
+	}
+
+	timeFormat := l.AccessLogTimeFormat
+	if timeFormat == "" {
+		timeFormat = "02/Jan/2006:15:04:05 -0700"
+	}
+
+	loc, err := time.LoadLocation(l.TimeZone)
+	if err != nil {
+		loc = time.Local
+	}
+
+	tokens := parseAccessLogFormat(format, timeFormat, loc)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		e := &accessLogEntry{
+			r:     r,
+			w:     &accessLogWriter{ResponseWriter: w},
+			start: time.Now(),
+		}
+
+		next.ServeHTTP(e.w, r)
+
+		e.elapsed = time.Since(e.start)
+		if e.w.status == 0 {
+			e.w.status = http.StatusOK
+		}
+
+		var b strings.Builder
+		for _, t := range tokens {
+			b.WriteString(t(e))
+		}
+		b.WriteByte('\n')
+
+		l.writeLog(logName, []byte(b.String()))
+	})
+}
+
+func parseAccessLogFormat(format string, timeFormat string, loc *time.Location) []accessLogToken {
+
+	var (
+		tokens  []accessLogToken
+		literal strings.Builder
+	)
+
+	flush := func() {
+		if literal.Len() > 0 {
+			s := literal.String()
+			tokens = append(tokens, func(*accessLogEntry) string { return s })
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(format); i++ {
+
+		if format[i] != '%' || i+1 >= len(format) {
+			literal.WriteByte(format[i])
+			continue
+		}
+
+		i++
+
+		// %{param}X
+		param := ""
+		if format[i] == '{' {
+			end := strings.IndexByte(format[i:], '}')
+			if end < 0 || i+end+1 >= len(format) {
+				literal.WriteString(format[i-1:])
+				break
+			}
+			param = format[i+1 : i+end]
+			i += end + 1
+		}
+
+		// %>s is the final status, the same thing here
+		if format[i] == '>' && i+1 < len(format) {
+			i++
+		}
+
+		if format[i] == '%' {
+			literal.WriteByte('%')
+			continue
+		}
+
+		t := accessLogDirective(format[i], param, timeFormat, loc)
+		if t == nil {
+			literal.WriteString("%" + string(format[i]))
+			continue
+		}
+
+		flush()
+		tokens = append(tokens, t)
+	}
+
+	flush()
+
+	return tokens
+}
+
+func accessLogDirective(c byte, param string, timeFormat string, loc *time.Location) accessLogToken {
+
+	switch c {
+	case 'h', 'a':
+		return func(e *accessLogEntry) string {
+			host, _, err := net.SplitHostPort(e.r.RemoteAddr)
+			if err != nil {
+				return dashIfEmpty(e.r.RemoteAddr)
+			}
+			return host
+		}
+	case 'l':
+		return func(*accessLogEntry) string { return "-" }
+	case 'u':
+		return func(e *accessLogEntry) string {
+			user, _, _ := e.r.BasicAuth()
+			return dashIfEmpty(user)
+		}
+	case 't':
+		return func(e *accessLogEntry) string { return "[" + e.start.In(loc).Format(timeFormat) + "]" }
+	case 'r':
+		return func(e *accessLogEntry) string { return e.r.Method + " " + e.r.RequestURI + " " + e.r.Proto }
+	case 'm':
+		return func(e *accessLogEntry) string { return e.r.Method }
+	case 'U':
+		return func(e *accessLogEntry) string { return e.r.URL.Path }
+	case 'q':
+		return func(e *accessLogEntry) string {
+			if e.r.URL.RawQuery == "" {
+				return ""
+			}
+			return "?" + e.r.URL.RawQuery
+		}
+	case 'H':
+		return func(e *accessLogEntry) string { return e.r.Proto }
+	case 's':
+		return func(e *accessLogEntry) string { return strconv.Itoa(e.w.status) }
+	case 'b':
+		return func(e *accessLogEntry) string {
+			if e.w.bytes == 0 {
+				return "-"
+			}
+			return strconv.FormatInt(e.w.bytes, 10)
+		}
+	case 'B':
+		return func(e *accessLogEntry) string { return strconv.FormatInt(e.w.bytes, 10) }
+	case 'D':
+		return func(e *accessLogEntry) string { return strconv.FormatInt(e.elapsed.Microseconds(), 10) }
+	case 'T':
+		if param == "ms" {
+			return func(e *accessLogEntry) string { return strconv.FormatInt(e.elapsed.Milliseconds(), 10) }
+		} else if param == "us" {
+			return func(e *accessLogEntry) string { return strconv.FormatInt(e.elapsed.Microseconds(), 10) }
+		}
+		return func(e *accessLogEntry) string { return strconv.FormatInt(int64(e.elapsed.Seconds()), 10) }
+	case 'i':
+		return func(e *accessLogEntry) string { return dashIfEmpty(e.r.Header.Get(param)) }
+	case 'o':
+		return func(e *accessLogEntry) string { return dashIfEmpty(e.w.Header().Get(param)) }
+	}
+
+	return nil
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
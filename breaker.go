@@ -0,0 +1,204 @@
+package mylib
+
+import (
+	"sync"
+	"time"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// Outcome of a call as seen by a breaker
+const (
+	breakerSuccess = iota
+	breakerFailure
+	breakerIgnored // canceled by the caller, says nothing about the host
+)
+
+type breakerGroup struct {
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+type breaker struct {
+	mu sync.Mutex
+
+	state       string
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	inFlight    int
+}
+
+func (p BreakerPolicy) enabled() bool {
+	return p.ConsecutiveFailures > 0 || p.FailureRatio > 0
+}
+
+func (p BreakerPolicy) coolDown() time.Duration {
+	if p.CoolDown <= 0 {
+		return 30 * time.Second
+	}
+	return p.CoolDown
+}
+
+func (p BreakerPolicy) window() time.Duration {
+	if p.Window <= 0 {
+		return time.Minute
+	}
+	return p.Window
+}
+
+func (p BreakerPolicy) minRequests() int {
+	if p.MinRequests <= 0 {
+		return 10
+	}
+	return p.MinRequests
+}
+
+func (p BreakerPolicy) halfOpenRequests() int {
+	if p.HalfOpenRequests <= 0 {
+		return 1
+	}
+	return p.HalfOpenRequests
+}
+
+func newBreakerGroup() *breakerGroup {
+	return &breakerGroup{breakers: make(map[string]*breaker)}
+}
+
+func (g *breakerGroup) get(host string) *breaker {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	b := g.breakers[host]
+	if b == nil {
+		b = &breaker{state: BreakerClosed, windowStart: time.Now()}
+		g.breakers[host] = b
+	}
+
+	return b
+}
+
+// Current state of every host seen so far ( an open breaker past its cool down
+// turns half-open on the next call )
+func (g *breakerGroup) states() map[string]string {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	out := make(map[string]string, len(g.breakers))
+	for host, b := range g.breakers {
+		b.mu.Lock()
+		out[host] = b.state
+		b.mu.Unlock()
+	}
+
+	return out
+}
+
+// Whether a call may go through, with the state before / after when it changed
+// and the time the breaker may let calls through again when rejected
+func (b *breaker) allow(p BreakerPolicy) (ok bool, from string, to string, retryAt time.Time) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.state
+
+	if b.state == BreakerOpen {
+
+		retryAt = b.openedAt.Add(p.coolDown())
+		if time.Now().Before(retryAt) {
+			return false, from, from, retryAt
+		}
+
+		b.state = BreakerHalfOpen
+		b.inFlight = 0
+	}
+
+	if b.state == BreakerHalfOpen {
+
+		if b.inFlight >= p.halfOpenRequests() {
+			return false, from, b.state, time.Now().Add(p.coolDown())
+		}
+
+		b.inFlight++
+	}
+
+	return true, from, b.state, retryAt
+}
+
+// Account the outcome of a call, returns the state before / after
+func (b *breaker) record(p BreakerPolicy, outcome int) (from string, to string) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.state
+
+	if b.state == BreakerHalfOpen {
+
+		if b.inFlight > 0 {
+			b.inFlight--
+		}
+
+		switch outcome {
+		case breakerSuccess:
+			b.reset()
+		case breakerFailure:
+			b.trip()
+		}
+
+		return from, b.state
+	}
+
+	// A late result of a call let through before the breaker opened
+	if b.state == BreakerOpen || outcome == breakerIgnored {
+		return from, b.state
+	}
+
+	if time.Since(b.windowStart) >= p.window() {
+		b.windowStart = time.Now()
+		b.requests = 0
+		b.failures = 0
+	}
+
+	b.requests++
+
+	if outcome == breakerSuccess {
+		b.consecutive = 0
+		return from, b.state
+	}
+
+	b.failures++
+	b.consecutive++
+
+	if (p.ConsecutiveFailures > 0 && b.consecutive >= p.ConsecutiveFailures) ||
+		(p.FailureRatio > 0 && b.requests >= p.minRequests() && float64(b.failures)/float64(b.requests) >= p.FailureRatio) {
+		b.trip()
+	}
+
+	return from, b.state
+}
+
+func (b *breaker) trip() {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+	b.inFlight = 0
+}
+
+func (b *breaker) reset() {
+	b.state = BreakerClosed
+	b.consecutive = 0
+	b.windowStart = time.Now()
+	b.requests = 0
+	b.failures = 0
+	b.inFlight = 0
+}
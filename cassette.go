@@ -0,0 +1,375 @@
+package mylib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Cassette modes
+const (
+	CassetteAuto   = "auto" // replay when the file exists, record otherwise
+	CassetteRecord = "record"
+	CassetteReplay = "replay"
+)
+
+// Headers of no use for matching
+var cassetteVolatileHeaders = []string{"User-Agent", "Content-Length"}
+
+// Cassette records HTTP calls to a file or replays them without network, plug it with
+// Middleware ( in PHttp.Middlewares for the Utils helpers )
+type Cassette struct {
+	l        *Utils
+	redactor *Utils
+	cfg      CassetteConfig
+	replay   bool
+
+	mu           sync.Mutex
+	interactions []CassetteInteraction
+	used         []bool
+}
+
+// Saved request / response pair
+type CassetteInteraction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+type CassetteRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	BodyBase64 bool        `json:"body_base64,omitempty"`
+}
+
+type cassetteFile struct {
+	Interactions []CassetteInteraction `json:"interactions"`
+}
+
+// NewCassette loads cfg.Path when replaying, a recording cassette starts empty
+func (l *Utils) NewCassette(cfg CassetteConfig) (*Cassette, error) {
+
+	k := &Cassette{l: l, redactor: &Utils{Redaction: cfg.Redaction}, cfg: cfg}
+
+	switch cfg.Mode {
+	case CassetteRecord:
+	case CassetteReplay:
+		k.replay = true
+	case "", CassetteAuto:
+		k.replay = fileExists(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q", cfg.Mode)
+	}
+
+	if k.replay {
+
+		data, err := os.ReadFile(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		var f cassetteFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("cassette %s : %w", cfg.Path, err)
+		}
+
+		k.interactions = f.Interactions
+		k.used = make([]bool, len(f.Interactions))
+	}
+
+	return k, nil
+}
+
+// Replaying, as opposed to recording
+func (k *Cassette) Replaying() bool {
+	return k.replay
+}
+
+// Interactions recorded or loaded so far
+func (k *Cassette) Interactions() []CassetteInteraction {
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return append([]CassetteInteraction(nil), k.interactions...)
+}
+
+// Middleware records what goes through next, or answers from the cassette without calling it
+//
+// Matching interactions are replayed in the recorded order, the last one again once all are used
+func (k *Cassette) Middleware() Middleware {
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+
+			r := req.Clone(req.Context())
+
+			body, err := readRequestBody(r)
+			if err != nil || k.replay {
+				// next never sees req, its body is ours to close
+				if req.Body != nil {
+					req.Body.Close()
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			if k.replay {
+				return k.play(r, body)
+			}
+
+			return k.record(next, r, body)
+		})
+	}
+}
+
+func (k *Cassette) record(next http.RoundTripper, req *http.Request, body []byte) (*http.Response, error) {
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	// The length of a redacted body differs, it is set again when replaying
+	header := k.redactor.RedactHeaders(resp.Header)
+	header.Del("Content-Length")
+
+	in := CassetteInteraction{
+		Request: k.request(req, body),
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     header,
+		},
+	}
+	in.Response.Body, in.Response.BodyBase64 = k.encodeBody(respBody)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.interactions = append(k.interactions, in)
+
+	if err := k.save(); err != nil {
+		k.l.writeHTTP(req.Context(), "error", fmt.Sprintf("Couldn't save cassette : %s, path : %s", err, k.cfg.Path))
+	}
+
+	return resp, nil
+}
+
+func (k *Cassette) play(req *http.Request, body []byte) (*http.Response, error) {
+
+	want := k.request(req, body)
+
+	k.mu.Lock()
+
+	found := -1
+	for i, in := range k.interactions {
+		if k.matches(in.Request, want) {
+			found = i
+			if !k.used[i] {
+				break
+			}
+		}
+	}
+
+	if found < 0 {
+
+		k.mu.Unlock()
+
+		err := fmt.Errorf("%w: %s %s", ErrCassetteMiss, want.Method, want.URL)
+		k.l.writeHTTP(req.Context(), "error", fmt.Sprintf("Cassette miss : %s, path : %s", err, k.cfg.Path))
+
+		return nil, err
+	}
+
+	k.used[found] = true
+	saved := k.interactions[found].Response
+
+	k.mu.Unlock()
+
+	respBody, err := decodeCassetteBody(saved.Body, saved.BodyBase64)
+	if err != nil {
+		return nil, err
+	}
+
+	status := saved.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", saved.StatusCode, http.StatusText(saved.StatusCode))
+	}
+
+	header := saved.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        status,
+		StatusCode:    saved.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// Request as saved : redacted & without the ignored headers
+func (k *Cassette) request(req *http.Request, body []byte) CassetteRequest {
+
+	header := k.redactor.RedactHeaders(req.Header)
+	for name := range header {
+		if k.ignoredHeader(name) {
+			header.Del(name)
+		}
+	}
+
+	out := CassetteRequest{
+		Method: req.Method,
+		URL:    k.redactor.RedactURL(req.URL.String()),
+		Header: header,
+	}
+	out.Body, out.BodyBase64 = k.encodeBody(body)
+
+	return out
+}
+
+func (k *Cassette) ignoredHeader(name string) bool {
+
+	if strings.EqualFold(name, RequestIDHeader) {
+		return true
+	}
+
+	for _, h := range cassetteVolatileHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+
+	for _, h := range k.cfg.IgnoreHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (k *Cassette) matches(saved CassetteRequest, live CassetteRequest) bool {
+
+	if !strings.EqualFold(saved.Method, live.Method) || k.matchURL(saved.URL) != k.matchURL(live.URL) {
+		return false
+	}
+
+	if k.cfg.MatchBody && (saved.Body != live.Body || saved.BodyBase64 != live.BodyBase64) {
+		return false
+	}
+
+	if k.cfg.MatchHeaders {
+
+		for name := range saved.Header {
+			if !k.ignoredHeader(name) && strings.Join(saved.Header.Values(name), ",") != strings.Join(live.Header.Values(name), ",") {
+				return false
+			}
+		}
+
+		for name := range live.Header {
+			if !k.ignoredHeader(name) && len(saved.Header.Values(name)) == 0 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Url without the ignored query parameters, the others sorted
+func (k *Cassette) matchURL(rawURL string) string {
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	for _, p := range k.cfg.IgnoreQueryParams {
+		q.Del(p)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// Redacted body, base64 when not text
+func (k *Cassette) encodeBody(body []byte) (string, bool) {
+
+	if len(body) == 0 {
+		return "", false
+	}
+
+	if !utf8.Valid(body) {
+		return base64.StdEncoding.EncodeToString(body), true
+	}
+
+	return k.redactor.RedactBody(body), false
+}
+
+func decodeCassetteBody(body string, isBase64 bool) ([]byte, error) {
+
+	if isBase64 {
+		return base64.StdEncoding.DecodeString(body)
+	}
+
+	return []byte(body), nil
+}
+
+// Write the cassette through a temporary file, must be called with k.mu held
+func (k *Cassette) save() error {
+
+	var data bytes.Buffer
+
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cassetteFile{Interactions: k.interactions}); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(k.cfg.Path), 0755); err != nil {
+		return err
+	}
+
+	tmp := k.cfg.Path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, k.cfg.Path)
+}
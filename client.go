@@ -0,0 +1,452 @@
+package mylib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	neturl "net/url"
+	"strconv"
+	"time"
+)
+
+// Client is a long-lived HTTP client built once from PHttp, its transport is shared
+// by every call so keep-alive connections are pooled and reused
+type Client struct {
+	l         *Utils
+	p         PHttp
+	transport *http.Transport
+	http      *http.Client
+
+	// Innermost round tripper & the middlewares wrapped around it
+	base        http.RoundTripper
+	middlewares []Middleware
+
+	// One shot clients of the Utils helpers close the connection after each call
+	closeConn bool
+
+	state *clientState
+}
+
+// Per host state outliving a single call
+type clientState struct {
+	breakers *breakerGroup
+	limiters *limiterGroup
+}
+
+// Shared by the one shot clients of the Utils helpers
+var sharedClientState = newClientState()
+
+func newClientState() *clientState {
+	return &clientState{breakers: newBreakerGroup(), limiters: newLimiterGroup()}
+}
+
+// Instance of a reusable HTTP client
+// param :
+// 1. @p ( transport settings, see PHttp ) -> PHttp
+// returns :
+// 1. @Client -> to be closed with Close when no longer used
+func (l *Utils) NewClient(p PHttp) *Client {
+
+	var rt http.RoundTripper
+
+	transport, err := newTransport(p)
+	if err != nil {
+
+		l.writeHTTP(context.Background(), "error", fmt.Sprintf("Error Occured : %s", err))
+
+		rt = errRoundTripper{err: err}
+	} else {
+		rt = transport
+	}
+
+	middlewares := append([]Middleware(nil), p.Middlewares...)
+
+	return &Client{
+		l:           l,
+		p:           p,
+		transport:   transport,
+		base:        rt,
+		middlewares: middlewares,
+		state:       newClientState(),
+		http: &http.Client{
+			Transport: Chain(rt, middlewares...),
+			Timeout:   p.Timeout * time.Second,
+		},
+	}
+}
+
+func (l *Utils) oneShotClient(p PHttp) *Client {
+
+	c := l.NewClient(p)
+	c.closeConn = true
+	c.state = sharedClientState
+
+	return c
+}
+
+// Underlying *http.Client, sharing the pooled transport
+func (c *Client) HTTPClient() *http.Client {
+	return c.http
+}
+
+// Circuit breaker state ( closed, open, half-open ) of every host called so far
+func (c *Client) BreakerStates() map[string]string {
+	return c.state.breakers.states()
+}
+
+// Circuit breaker states of the hosts called through the Utils helpers ( Get, Post, Upload, Do ... )
+func BreakerStates() map[string]string {
+	return sharedClientState.breakers.states()
+}
+
+// Token buckets of PHttp.RateLimits used so far
+func (c *Client) RateLimiterStates() []RateLimiterState {
+	return c.state.limiters.states()
+}
+
+// Token buckets used through the Utils helpers ( Get, Post, Upload, Do ... )
+func RateLimiterStates() []RateLimiterState {
+	return sharedClientState.limiters.states()
+}
+
+// Close releases the idle connections of the pool
+func (c *Client) Close() {
+	c.transport.CloseIdleConnections()
+}
+
+func (c *Client) Get(url string, headers map[string]string) ([]byte, string, int, error) {
+	return c.GetCtx(context.Background(), url, headers)
+}
+
+// GetCtx, Get canceled when ctx is done ( see ErrRequestCanceled & ErrRequestTimeout )
+func (c *Client) GetCtx(ctx context.Context, url string, headers map[string]string) ([]byte, string, int, error) {
+	return responseTuple(c.send(ctx, "GET", url, headers, nil))
+}
+
+func (c *Client) Post(url string, headers map[string]string, body []byte) ([]byte, string, int, error) {
+	return c.PostCtx(context.Background(), url, headers, body)
+}
+
+// PostCtx, Post canceled when ctx is done ( see ErrRequestCanceled & ErrRequestTimeout )
+func (c *Client) PostCtx(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, string, int, error) {
+	return responseTuple(c.send(ctx, "POST", url, headers, body))
+}
+
+// Upload a file as the "file" multipart field
+func (c *Client) Upload(url string, headers map[string]string, extraParams map[string]string, filepath string) ([]byte, string, int, error) {
+	return c.UploadCtx(context.Background(), url, headers, extraParams, filepath)
+}
+
+// UploadCtx, Upload canceled when ctx is done
+func (c *Client) UploadCtx(ctx context.Context, url string, headers map[string]string, extraParams map[string]string, filepath string) ([]byte, string, int, error) {
+	return responseTuple(c.UploadFiles(ctx, url, headers, extraParams, []UploadFile{{Path: filepath}}, nil))
+}
+
+// Shared by every verb : send with the retry policy of PHttp, each attempt is logged
+// The response is nil when no attempt got one
+func (c *Client) send(ctx context.Context, method string, url string, headers map[string]string, body []byte) (*Response, error) {
+	return c.sendBody(ctx, method, url, headers, requestBody{data: body})
+}
+
+// Body of a request, either in memory or streamed from open for each attempt
+type requestBody struct {
+	data []byte
+
+	open   func() (io.ReadCloser, error)
+	replay func() (io.ReadCloser, error) // GetBody of a streamed body, open when nil
+	size   int64                         // of a streamed body, -1 when unknown
+	log    string                        // logged in place of a streamed body, or of data when set
+}
+
+// send with any kind of body
+func (c *Client) sendBody(ctx context.Context, method string, url string, headers map[string]string, body requestBody) (*Response, error) {
+
+	attempts := c.p.Retry.attempts(method, headers)
+
+	for attempt := 1; ; attempt++ {
+
+		b, err := c.breakerAllow(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.rateLimit(ctx, url); err != nil {
+			c.breakerRecord(ctx, b, url, attemptResult{permanent: true})
+			return nil, err
+		}
+
+		res := c.sendOnce(ctx, method, url, headers, body, attempt, attempts)
+		if res.resp != nil {
+			res.resp.Attempts = attempt
+		}
+
+		c.breakerRecord(ctx, b, url, res)
+
+		if attempt >= attempts || res.permanent || !c.p.Retry.retryable(ctx, res.code(), res.err) {
+			return res.resp, res.err
+		}
+
+		var header http.Header
+		if res.resp != nil {
+			header = res.resp.Header
+		}
+
+		delay := c.p.Retry.backoff(attempt, header)
+
+		c.l.writeHTTP(ctx, "info",
+			fmt.Sprintf("Retrying Hit: %s, Attempt: %d/%d, Status Code: %d, Error: %s, Backoff: %s", c.l.RedactURL(url), attempt, attempts, res.code(), c.l.redactErr(res.err), delay),
+		)
+
+		if err := sleepCtx(ctx, delay); err != nil {
+			return res.resp, wrapRequestError(ctx, err)
+		}
+	}
+}
+
+// Legacy ( body, status, status code, error ) returns of the helpers
+func responseTuple(res *Response, err error) ([]byte, string, int, error) {
+
+	if res == nil {
+		return []byte(""), "", 0, err
+	}
+
+	return res.Body, res.Status, res.StatusCode, err
+}
+
+type attemptResult struct {
+	resp *Response
+	err  error
+
+	// The request could not even be built, the tls config is invalid or a cassette has no answer, no retry
+	permanent bool
+}
+
+// A single attempt : send, trace, read the body and log the exchange
+// ( the request body is logged only when there is one, the attempt number only when retrying is allowed )
+func (c *Client) sendOnce(ctx context.Context, method string, url string, headers map[string]string, body requestBody, attempt int, attempts int) attemptResult {
+
+	l := c.l
+
+	var (
+		respBody    []byte
+		elapseInSec string
+		elapseInMS  string
+		reqBody     io.Reader
+		reqLog      string
+		attemptLog  string
+	)
+
+	if attempts > 1 {
+		attemptLog = fmt.Sprintf(", Attempt: %d/%d", attempt, attempts)
+	}
+
+	if body.open != nil {
+
+		rc, err := body.open()
+		if err != nil {
+			l.writeHTTP(ctx, "error",
+				fmt.Sprintf("Couldn't open request body : %s, Hit: %s%s", l.redactErr(err), l.RedactURL(url), attemptLog),
+			)
+
+			return attemptResult{err: err, permanent: true}
+		}
+
+		reqBody = rc
+		reqLog = ", Request: " + body.log
+	} else if body.data != nil {
+		reqBody = bytes.NewReader(body.data)
+		if body.log != "" {
+			reqLog = ", Request: " + body.log
+		} else {
+			reqLog = ", Request: " + l.logBody(body.data, headerValue(headers, "Content-Type"))
+		}
+	}
+
+	req, err := newRequest(ctx, method, url, reqBody, headers)
+	if err != nil {
+		if rc, ok := reqBody.(io.Closer); ok && body.open != nil {
+			rc.Close()
+		}
+
+		l.writeHTTP(ctx, "error",
+			fmt.Sprintf("Error Occured : %s", l.redactErr(err)),
+		)
+
+		return attemptResult{err: err, permanent: true}
+	}
+	req.Close = c.closeConn
+
+	if body.open != nil {
+		// Unknown sizes go chunked, GetBody lets redirects replay the body
+		if body.size > 0 {
+			req.ContentLength = body.size
+		}
+		req.GetBody = body.open
+		if body.replay != nil {
+			req.GetBody = body.replay
+		}
+	}
+
+	trace := newTimingTrace()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	response, err := c.http.Do(req)
+	if err != nil {
+
+		err = wrapRequestError(ctx, err)
+
+		l.writeHTTPFields(ctx, "error",
+			fmt.Sprintf("Error sending request to API endpoint : %s, Hit: %s%s%s", l.redactErr(err), l.RedactURL(url), reqLog, attemptLog),
+			trace.done().fields(),
+		)
+
+		return attemptResult{err: err, permanent: errors.Is(err, ErrTLSConfig) || errors.Is(err, ErrCassetteMiss)}
+	}
+
+	// Close the connection to reuse it
+	defer response.Body.Close()
+
+	respBody, err = io.ReadAll(response.Body)
+	err = wrapRequestError(ctx, err)
+
+	timings := trace.done()
+
+	elapseInSec = fmt.Sprintf("%f", timings.Total.Seconds())
+	elapseInMS = strconv.FormatInt(timings.Total.Milliseconds(), 10)
+
+	if err != nil {
+
+		l.writeHTTPFields(ctx, "error",
+			fmt.Sprintf("Couldn't parse response body : %s, Hit: %s%s%s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond", l.redactErr(err), l.RedactURL(url), reqLog, attemptLog, l.logBody(respBody, response.Header.Get("Content-Type")), response.Status, response.StatusCode, elapseInSec, elapseInMS),
+			timings.fields(),
+		)
+
+		return attemptResult{err: err}
+	}
+
+	l.writeHTTPFields(ctx, "info",
+		fmt.Sprintf("Hit: %s%s%s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond", l.RedactURL(url), reqLog, attemptLog, l.logBody(respBody, response.Header.Get("Content-Type")), response.Status, response.StatusCode, elapseInSec, elapseInMS),
+		timings.fields(),
+	)
+
+	return attemptResult{resp: &Response{
+		Method:     method,
+		URL:        response.Request.URL.String(),
+		Status:     response.Status,
+		StatusCode: response.StatusCode,
+		Proto:      response.Proto,
+		Header:     response.Header,
+		Cookies:    response.Cookies(),
+		Body:       respBody,
+		Elapsed:    timings.Total,
+		Timings:    timings,
+	}}
+}
+
+func (r attemptResult) code() int {
+	if r.resp == nil {
+		return 0
+	}
+	return r.resp.StatusCode
+}
+
+// Breaker of the host of url when PHttp.Breaker is set, a *CircuitOpenError when the call must not go through
+func (c *Client) breakerAllow(ctx context.Context, rawURL string) (*breaker, error) {
+
+	if !c.p.Breaker.enabled() {
+		return nil, nil
+	}
+
+	host := hostOf(rawURL)
+	b := c.state.breakers.get(host)
+
+	ok, from, to, retryAt := b.allow(c.p.Breaker)
+	c.logBreaker(ctx, host, from, to)
+
+	if !ok {
+
+		err := &CircuitOpenError{Host: host, RetryAt: retryAt}
+
+		c.l.writeHTTP(ctx, "error",
+			fmt.Sprintf("Short-circuited Hit: %s, Error: %s", c.l.RedactURL(rawURL), err),
+		)
+
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (c *Client) breakerRecord(ctx context.Context, b *breaker, rawURL string, res attemptResult) {
+
+	if b == nil {
+		return
+	}
+
+	outcome := breakerSuccess
+	if res.permanent || (res.err != nil && ctx.Err() != nil) {
+		outcome = breakerIgnored
+	} else if res.err != nil || res.code() >= 500 {
+		outcome = breakerFailure
+	}
+
+	from, to := b.record(c.p.Breaker, outcome)
+	c.logBreaker(ctx, hostOf(rawURL), from, to)
+}
+
+func (c *Client) logBreaker(ctx context.Context, host string, from string, to string) {
+
+	if from == to {
+		return
+	}
+
+	level := "info"
+	if to == BreakerOpen {
+		level = "error"
+	}
+
+	c.l.writeHTTP(ctx, level, fmt.Sprintf("Circuit breaker, Host: %s, State: %s -> %s", host, from, to))
+}
+
+// Take a token from the first PHttp.RateLimits rule matching url
+func (c *Client) rateLimit(ctx context.Context, rawURL string) error {
+
+	rule := matchRateLimit(c.p.RateLimits, rawURL)
+	if rule == nil {
+		return nil
+	}
+
+	waited, err := c.state.limiters.get(rule).wait(ctx, rule.FailFast)
+	if err != nil {
+
+		err = wrapRequestError(ctx, err)
+
+		c.l.writeHTTP(ctx, "error",
+			fmt.Sprintf("Rate limited Hit: %s, Limit: %s, Error: %s", c.l.RedactURL(rawURL), rule.key(), err),
+		)
+
+		return err
+	}
+
+	if waited > 0 {
+		c.l.writeHTTP(ctx, "debug",
+			fmt.Sprintf("Rate limit wait Hit: %s, Limit: %s, Waited: %s", c.l.RedactURL(rawURL), rule.key(), waited),
+		)
+	}
+
+	return nil
+}
+
+func hostOf(rawURL string) string {
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	return u.Host
+}
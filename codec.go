@@ -0,0 +1,145 @@
+package mylib
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeXML  = "application/xml; charset=utf-8"
+)
+
+type codec struct {
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+	unmarshal   func(data []byte, v interface{}) error
+}
+
+var (
+	jsonCodec = codec{contentType: ContentTypeJSON, marshal: json.Marshal, unmarshal: json.Unmarshal}
+
+	xmlCodec = codec{
+		contentType: ContentTypeXML,
+		marshal: func(v interface{}) ([]byte, error) {
+			b, err := xml.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			return append([]byte(xml.Header), b...), nil
+		},
+		unmarshal: xml.Unmarshal,
+	}
+)
+
+// JSON sends in as a json body and decodes the response
+// param :
+// 1. @in ( marshalled to json, []byte is sent as is, nil = no body ) -> interface{}
+// 2. @out ( filled from a 2xx body, nil to ignore it ) -> pointer
+// 3. @errOut ( filled from a non 2xx body, nil to ignore it ) -> pointer
+// returns :
+// 1. @Response, @error ( a *StatusError for a non 2xx status )
+//
+// Content-Type & Accept are set unless given in headers
+func (c *Client) JSON(ctx context.Context, method string, url string, headers map[string]string, in interface{}, out interface{}, errOut interface{}) (*Response, error) {
+	return c.codecRequest(ctx, jsonCodec, method, url, headers, in, out, errOut)
+}
+
+// XML, the JSON helper for xml bodies ( the request is prefixed with xml.Header )
+func (c *Client) XML(ctx context.Context, method string, url string, headers map[string]string, in interface{}, out interface{}, errOut interface{}) (*Response, error) {
+	return c.codecRequest(ctx, xmlCodec, method, url, headers, in, out, errOut)
+}
+
+// JSON builds a one shot client from transport, prefer NewClient for repeated calls
+func (l *Utils) JSON(ctx context.Context, method string, url string, headers map[string]string, in interface{}, out interface{}, errOut interface{}, transport PHttp) (*Response, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.JSON(ctx, method, url, headers, in, out, errOut)
+}
+
+// XML builds a one shot client from transport, prefer NewClient for repeated calls
+func (l *Utils) XML(ctx context.Context, method string, url string, headers map[string]string, in interface{}, out interface{}, errOut interface{}, transport PHttp) (*Response, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.XML(ctx, method, url, headers, in, out, errOut)
+}
+
+func (c *Client) codecRequest(ctx context.Context, cd codec, method string, url string, headers map[string]string, in interface{}, out interface{}, errOut interface{}) (*Response, error) {
+
+	var body []byte
+
+	switch v := in.(type) {
+	case nil:
+	case []byte:
+		body = v
+	default:
+		b, err := cd.marshal(in)
+		if err != nil {
+			c.l.writeHTTP(ctx, "error", fmt.Sprintf("Couldn't encode request body : %s, Hit: %s", err, c.l.RedactURL(url)))
+			return nil, err
+		}
+		body = b
+	}
+
+	h := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		h[k] = v
+	}
+	if body != nil && headerValue(h, "Content-Type") == "" {
+		h["Content-Type"] = cd.contentType
+	}
+	if headerValue(h, "Accept") == "" {
+		h["Accept"] = cd.contentType
+	}
+
+	res, err := c.send(ctx, strings.ToUpper(method), url, h, body)
+	if err != nil {
+		return res, err
+	}
+
+	target := out
+	if !res.IsSuccess() {
+		target = errOut
+	}
+
+	if target != nil && len(strings.TrimSpace(string(res.Body))) != 0 {
+
+		if derr := cd.unmarshal(res.Body, target); derr != nil && res.IsSuccess() {
+
+			c.l.writeHTTP(ctx, "error", fmt.Sprintf("Couldn't decode response body : %s, Hit: %s", derr, c.l.RedactURL(url)))
+
+			return res, derr
+		}
+	}
+
+	return res, res.ErrorForStatus()
+}
+
+// Value of a header of a headers map, case insensitive
+func headerValue(headers map[string]string, name string) string {
+
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// Body as logged by the HTTP helpers : xml is compacted with InlinePrintingXML, then redacted
+func (l *Utils) logBody(body []byte, contentType string) string {
+
+	if strings.Contains(strings.ToLower(contentType), "xml") {
+		return l.RedactBody([]byte(InlinePrintingXML(string(body))))
+	}
+
+	return l.RedactBody(body)
+}
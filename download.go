@@ -0,0 +1,447 @@
+package mylib
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Download streams url to dest through dest + ".part", renamed once complete & verified
+// param :
+// 1. @dest ( final path, its directory is created when missing ) -> string
+// 2. @opt ( checksum, progress, see DownloadOptions ) -> DownloadOptions
+// returns :
+// 1. @Response ( without the body ), @error
+//
+// A ".part" left by an interrupted call or attempt is resumed with a Range request,
+// guarded by If-Range with the ETag / Last-Modified kept in ".part.validator" :
+// a server ignoring it, or a changed file, sends the whole file again. A ".part"
+// without a known validator is downloaded again from zero. PHttp.Timeout covers
+// the whole transfer, keep it 0 ( or use ctx ) for large files
+func (c *Client) Download(ctx context.Context, url string, headers map[string]string, dest string, opt DownloadOptions) (*Response, error) {
+
+	l := c.l
+
+	sum, err := newChecksum(opt.Checksum)
+	if err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Error Occured : %s, Hit: %s", err, l.RedactURL(url)))
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Error Occured : %s, Hit: %s", err, l.RedactURL(url)))
+		return nil, err
+	}
+
+	part := dest + ".part"
+	attempts := c.p.Retry.attempts("GET", headers)
+
+	// ETag or Last-Modified of the response part was started from, so a changed file is not resumed
+	validator := readValidator(part)
+
+	for attempt := 1; ; attempt++ {
+
+		b, err := c.breakerAllow(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.rateLimit(ctx, url); err != nil {
+			c.breakerRecord(ctx, b, url, attemptResult{permanent: true})
+			return nil, err
+		}
+
+		res, complete := c.downloadOnce(ctx, url, headers, part, &validator, opt, attempt, attempts)
+		if res.resp != nil {
+			res.resp.Attempts = attempt
+		}
+
+		c.breakerRecord(ctx, b, url, res)
+
+		if complete {
+			return res.resp, c.finishDownload(ctx, url, part, dest, sum)
+		}
+
+		if attempt >= attempts || res.permanent || !c.p.Retry.retryable(ctx, res.code(), res.err) {
+			if res.err == nil && res.resp != nil {
+				return res.resp, res.resp.ErrorForStatus()
+			}
+			return res.resp, res.err
+		}
+
+		var header http.Header
+		if res.resp != nil {
+			header = res.resp.Header
+		}
+
+		delay := c.p.Retry.backoff(attempt, header)
+
+		l.writeHTTP(ctx, "info",
+			fmt.Sprintf("Retrying Download Hit: %s, Attempt: %d/%d, Status Code: %d, Error: %s, Backoff: %s", l.RedactURL(url), attempt, attempts, res.code(), l.redactErr(res.err), delay),
+		)
+
+		if err := sleepCtx(ctx, delay); err != nil {
+			return res.resp, wrapRequestError(ctx, err)
+		}
+	}
+}
+
+// Download builds a one shot client from transport, prefer NewClient for repeated calls
+func (l *Utils) Download(ctx context.Context, url string, headers map[string]string, dest string, opt DownloadOptions, transport PHttp) (*Response, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.Download(ctx, url, headers, dest, opt)
+}
+
+// A single attempt appending to part, complete when part holds the whole file
+func (c *Client) downloadOnce(ctx context.Context, url string, headers map[string]string, part string, validator *string, opt DownloadOptions, attempt int, attempts int) (res attemptResult, complete bool) {
+
+	l := c.l
+
+	var attemptLog string
+	if attempts > 1 {
+		attemptLog = fmt.Sprintf(", Attempt: %d/%d", attempt, attempts)
+	}
+
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	// Without a validator a changed file can't be told apart, start over
+	if offset > 0 && *validator == "" {
+		removePart(part)
+		offset = 0
+	}
+
+	h := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		h[k] = v
+	}
+	if offset > 0 {
+		h["Range"] = fmt.Sprintf("bytes=%d-", offset)
+		h["If-Range"] = *validator
+	}
+
+	req, err := newRequest(ctx, "GET", url, nil, h)
+	if err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Error Occured : %s", l.redactErr(err)))
+		return attemptResult{err: err, permanent: true}, false
+	}
+	req.Close = c.closeConn
+
+	trace := newTimingTrace()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	response, err := c.http.Do(req)
+	if err != nil {
+
+		err = wrapRequestError(ctx, err)
+
+		l.writeHTTPFields(ctx, "error",
+			fmt.Sprintf("Error sending request to API endpoint : %s, Hit: %s, File: %s%s", l.redactErr(err), l.RedactURL(url), part, attemptLog),
+			trace.done().fields(),
+		)
+
+		return attemptResult{err: err}, false
+	}
+	defer response.Body.Close()
+
+	resp := &Response{
+		Method:     "GET",
+		URL:        response.Request.URL.String(),
+		Status:     response.Status,
+		StatusCode: response.StatusCode,
+		Proto:      response.Proto,
+		Header:     response.Header,
+		Cookies:    response.Cookies(),
+	}
+
+	total := int64(-1)
+	flag := os.O_WRONLY | os.O_CREATE
+
+	switch response.StatusCode {
+
+	case http.StatusPartialContent:
+
+		start, size, ok := parseContentRange(response.Header.Get("Content-Range"))
+		if !ok || start != offset {
+
+			removePart(part)
+
+			return attemptResult{resp: resp, err: fmt.Errorf("%w: unexpected Content-Range %q from offset %d", ErrIncompleteDownload, response.Header.Get("Content-Range"), offset)}, false
+		}
+
+		total = size
+		flag |= os.O_APPEND
+
+	case http.StatusOK:
+
+		// Range ignored or the file changed, start over
+		offset = 0
+		total = response.ContentLength
+		flag |= os.O_TRUNC
+
+		*validator = responseValidator(response.Header)
+		writeValidator(part, *validator)
+
+	case http.StatusRequestedRangeNotSatisfiable:
+
+		// Nothing left to send when part already holds the whole file
+		if _, size, ok := parseContentRange(response.Header.Get("Content-Range")); ok && offset > 0 && size == offset {
+			return attemptResult{resp: resp}, true
+		}
+
+		removePart(part)
+
+		return attemptResult{resp: resp, err: fmt.Errorf("%w: range from offset %d not satisfiable", ErrIncompleteDownload, offset)}, false
+
+	default:
+
+		resp.Body, _ = io.ReadAll(io.LimitReader(response.Body, 64<<10))
+		timings := trace.done()
+		resp.Elapsed, resp.Timings = timings.Total, timings
+
+		l.writeHTTPFields(ctx, "error",
+			fmt.Sprintf("Failed download, Hit: %s%s, Response: %s, Status: %s, Status Code: %d", l.RedactURL(url), attemptLog, l.logBody(resp.Body, response.Header.Get("Content-Type")), response.Status, response.StatusCode),
+			timings.fields(),
+		)
+
+		return attemptResult{resp: resp}, false
+	}
+
+	perm := opt.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+
+	f, err := os.OpenFile(part, flag, perm)
+	if err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Failed open file : %v, path : %s", err, part))
+		return attemptResult{resp: resp, err: err, permanent: true}, false
+	}
+
+	var body io.Reader = response.Body
+	if opt.Progress != nil {
+		if offset > 0 {
+			opt.Progress(offset, total)
+		}
+		body = &progressReader{r: response.Body, done: offset, total: total, progress: opt.Progress}
+	}
+
+	n, err := io.Copy(f, body)
+	if serr := f.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	err = wrapRequestError(ctx, err)
+
+	timings := trace.done()
+	resp.Elapsed, resp.Timings = timings.Total, timings
+
+	fields := timings.fields()
+	fields["offset"] = offset
+	fields["bytes"] = n
+
+	if err == nil && total >= 0 && offset+n != total {
+		err = fmt.Errorf("%w: %d of %d bytes", ErrIncompleteDownload, offset+n, total)
+	}
+
+	if err != nil {
+
+		l.writeHTTPFields(ctx, "error",
+			fmt.Sprintf("Interrupted download : %s, Hit: %s, File: %s%s, Status: %s, Status Code: %d", l.redactErr(err), l.RedactURL(url), part, attemptLog, response.Status, response.StatusCode),
+			fields,
+		)
+
+		return attemptResult{resp: resp, err: err}, false
+	}
+
+	l.writeHTTPFields(ctx, "info",
+		fmt.Sprintf("Download Hit: %s, File: %s%s, Status: %s, Status Code: %d, Elapse: %f second", l.RedactURL(url), part, attemptLog, response.Status, response.StatusCode, timings.Total.Seconds()),
+		fields,
+	)
+
+	return attemptResult{resp: resp}, true
+}
+
+// Verify part against the checksum and move it to dest
+func (c *Client) finishDownload(ctx context.Context, url string, part string, dest string, sum *checksum) error {
+
+	l := c.l
+
+	if sum != nil {
+
+		got, err := sum.file(part)
+		if err != nil {
+			l.writeHTTP(ctx, "error", fmt.Sprintf("Failed open file : %v, path : %s", err, part))
+			return err
+		}
+
+		if !strings.EqualFold(got, sum.want) {
+
+			removePart(part)
+
+			err := fmt.Errorf("%w: %s %s, expected %s", ErrChecksumMismatch, sum.algorithm, got, sum.want)
+			l.writeHTTP(ctx, "error", fmt.Sprintf("Failed download : %s, Hit: %s, File: %s", err, l.RedactURL(url), dest))
+
+			return err
+		}
+	}
+
+	if err := os.Rename(part, dest); err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Failed rename file : %v, path : %s", err, dest))
+		return err
+	}
+	os.Remove(part + ".validator")
+
+	l.writeHTTP(ctx, "info", fmt.Sprintf("Success download, Hit: %s, File: %s", l.RedactURL(url), dest))
+
+	return nil
+}
+
+// Strong ETag of a response, else its Last-Modified
+func responseValidator(h http.Header) string {
+
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return h.Get("Last-Modified")
+}
+
+// Validator saved next to part, empty when unknown
+func readValidator(part string) string {
+
+	b, err := os.ReadFile(part + ".validator")
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
+
+// Save the validator of part, an unsaved one only costs a download from zero next time
+func writeValidator(part string, validator string) {
+
+	if validator == "" {
+		os.Remove(part + ".validator")
+		return
+	}
+
+	os.WriteFile(part+".validator", []byte(validator), 0644)
+}
+
+// Remove part and its validator
+func removePart(part string) {
+	os.Remove(part)
+	os.Remove(part + ".validator")
+}
+
+// "bytes <start>-<end>/<size>" or "bytes */<size>", size is -1 when "*"
+func parseContentRange(v string) (start int64, size int64, ok bool) {
+
+	v = strings.TrimSpace(v)
+	if !strings.HasPrefix(v, "bytes ") {
+		return 0, 0, false
+	}
+
+	rng, total, found := strings.Cut(strings.TrimPrefix(v, "bytes "), "/")
+	if !found {
+		return 0, 0, false
+	}
+
+	size = -1
+	if total != "*" {
+		n, err := strconv.ParseInt(total, 10, 64)
+		if err != nil {
+			return 0, 0, false
+		}
+		size = n
+	}
+
+	if rng == "*" {
+		return 0, size, true
+	}
+
+	first, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return start, size, true
+}
+
+type checksum struct {
+	algorithm string
+	want      string
+	new       func() hash.Hash
+}
+
+// Parse "<algorithm>:<hex>", nil when empty
+func newChecksum(v string) (*checksum, error) {
+
+	if v == "" {
+		return nil, nil
+	}
+
+	algorithm, want, found := strings.Cut(v, ":")
+	if !found || want == "" {
+		return nil, fmt.Errorf("invalid checksum %q, expected <algorithm>:<hex>", v)
+	}
+
+	algorithm = strings.ToLower(algorithm)
+
+	var fn func() hash.Hash
+	switch algorithm {
+	case "md5":
+		fn = md5.New
+	case "sha1":
+		fn = sha1.New
+	case "sha256":
+		fn = sha256.New
+	case "sha512":
+		fn = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+
+	return &checksum{algorithm: algorithm, want: want, new: fn}, nil
+}
+
+func (c *checksum) file(path string) (string, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := c.new()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,136 @@
+package mylib
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+var (
+	// Returned ( wrapped ) when the context of a call was canceled
+	ErrRequestCanceled = errors.New("request canceled")
+
+	// Returned ( wrapped ) when a call hit its context deadline or PHttp.Timeout
+	ErrRequestTimeout = errors.New("request timeout")
+
+	// Matches any *CircuitOpenError with errors.Is
+	ErrCircuitOpen = errors.New("circuit breaker open")
+
+	// Returned ( wrapped ) by a fail fast rate limit without a token available
+	ErrRateLimited = errors.New("rate limited")
+
+	// Returned ( wrapped ) by every call of a client built with an invalid PHttp.TLS
+	ErrTLSConfig = errors.New("invalid tls config")
+
+	// Returned ( wrapped ) when no certificate of the chain matches PHttp.TLS.PinnedSPKI
+	ErrCertificatePin = errors.New("certificate pin mismatch")
+
+	// Returned ( wrapped ) when a download ended before Content-Length / Content-Range bytes
+	ErrIncompleteDownload = errors.New("incomplete download")
+
+	// Returned ( wrapped ) when a downloaded file does not match DownloadOptions.Checksum
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// Returned ( wrapped ) by HMACSigner.Verify for a missing or wrong signature
+	ErrSignatureInvalid = errors.New("invalid signature")
+
+	// Returned ( wrapped ) by HMACSigner.Verify when the timestamp is outside MaxSkew
+	ErrSignatureExpired = errors.New("signature timestamp out of range")
+
+	// Returned ( wrapped ) by a replaying cassette without an interaction matching the request
+	ErrCassetteMiss = errors.New("no matching cassette interaction")
+
+	// Matches any *SOAPFault with errors.Is
+	ErrSOAPFault = errors.New("soap fault")
+)
+
+// Returned without sending when the circuit breaker of the host is open
+type CircuitOpenError struct {
+	Host    string
+	RetryAt time.Time // earliest time a trial request is let through
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s for %s until %s", ErrCircuitOpen, e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// Tag an HTTP error as canceled or timed out, so callers can test it with errors.Is
+func wrapRequestError(ctx context.Context, err error) error {
+
+	if err == nil || errors.Is(err, ErrRequestCanceled) || errors.Is(err, ErrRequestTimeout) {
+		return err
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("%w: %w", ErrRequestCanceled, err)
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrRequestTimeout, err)
+	}
+
+	return err
+}
+
+// Non 2xx status, see Response.ErrorForStatus
+type StatusError struct {
+	Method     string
+	URL        string
+	Status     string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s : unexpected status %s", e.Method, e.URL, e.Status)
+}
+
+// SOAP Fault of a 1.1 or 1.2 response
+type SOAPFault struct {
+	Version    string
+	StatusCode int
+	Code       string // faultcode (1.1) or Code/Value (1.2)
+	Subcode    string // Code/Subcode/Value (1.2)
+	String     string // faultstring (1.1) or the first Reason/Text (1.2)
+	Actor      string // faultactor (1.1) or Node (1.2)
+	Role       string // Role (1.2)
+	Detail     []byte // raw content of detail / Detail, see DecodeDetail
+}
+
+func (e *SOAPFault) Error() string {
+	return fmt.Sprintf("%s %s : %s", ErrSOAPFault, e.Code, e.String)
+}
+
+func (e *SOAPFault) Is(target error) bool {
+	return target == ErrSOAPFault
+}
+
+// DecodeDetail unmarshals the first element of the fault detail into v
+func (e *SOAPFault) DecodeDetail(v interface{}) error {
+	return xml.Unmarshal(e.Detail, v)
+}
+
+// Error response of an OAuth2 token endpoint
+type OAuth2Error struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+	URI         string `json:"error_uri"`
+}
+
+func (e *OAuth2Error) Error() string {
+
+	if e.Description != "" {
+		return fmt.Sprintf("oauth2 token error %s ( status %d ) : %s", e.Code, e.StatusCode, e.Description)
+	}
+
+	return fmt.Sprintf("oauth2 token error %s ( status %d )", e.Code, e.StatusCode)
+}
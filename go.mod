@@ -1,6 +1,6 @@
 module github.com/wiliehidayat87/mylib/v2
 
-go 1.20
+go 1.21
 
 retract (
 	v2.1.8 // Contains retractions only.
@@ -0,0 +1,260 @@
+package mylib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultHMACTemplate = "{method}\n{path}\n{timestamp}\n{body_hash}"
+
+// "{header:Name}" placeholders of HMACConfig.Template
+var hmacHeaderPlaceholder = regexp.MustCompile(`\{header:([^}]+)\}`)
+
+// HMACSigner signs outbound requests and verifies inbound ones with the same HMACConfig
+//
+// Template placeholders : {method} {path} {query} {host} {timestamp} {body_hash} {key_id} {header:Name}
+type HMACSigner struct {
+	cfg    HMACConfig
+	digest func(s string) string      // hex, of the body
+	mac    func(key, s string) string // hex, of the canonical string
+}
+
+// NewHMACSigner fails on an unknown algorithm
+func NewHMACSigner(cfg HMACConfig) (*HMACSigner, error) {
+
+	s := &HMACSigner{}
+
+	var fn func() hash.Hash
+	switch strings.ToLower(cfg.Algorithm) {
+	case "", "sha256":
+		s.digest, s.mac = GetSHA256, GetHMACSHA256
+	case "sha512":
+		fn = sha512.New
+	case "sha1":
+		fn = sha1.New
+	default:
+		return nil, fmt.Errorf("unsupported hmac algorithm %q", cfg.Algorithm)
+	}
+
+	if fn != nil {
+		s.digest = func(v string) string { return hexDigest(fn, v) }
+		s.mac = func(key, v string) string { return hexHMAC(fn, key, v) }
+	}
+
+	if cfg.Template == "" {
+		cfg.Template = defaultHMACTemplate
+	}
+	if cfg.Header == "" {
+		cfg.Header = "X-Signature"
+	}
+	if cfg.TimestampHeader == "" {
+		cfg.TimestampHeader = "X-Timestamp"
+	}
+	if cfg.KeyIDHeader == "" {
+		cfg.KeyIDHeader = "X-Key-Id"
+	}
+	if cfg.MaxSkew <= 0 {
+		cfg.MaxSkew = 5 * time.Minute
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = 10 << 20
+	}
+
+	s.cfg = cfg
+
+	return s, nil
+}
+
+// Sign sets the timestamp, key id & signature headers of req, the body is read and put back
+func (s *HMACSigner) Sign(req *http.Request) error {
+
+	body, err := readRequestBody(req)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(s.cfg.TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	if s.cfg.KeyID != "" {
+		req.Header.Set(s.cfg.KeyIDHeader, s.cfg.KeyID)
+	}
+
+	req.Header.Set(s.cfg.Header, s.signature(req, body))
+
+	return nil
+}
+
+// Middleware signs every attempt of the calls of a client, after the middlewares it wraps
+// ( put it last so the headers they set can be part of the template )
+// The body is read once more to be hashed, a streamed one ( UploadFiles ) is rebuilt
+// without running its progress callbacks, but all of it is held in memory while signing
+func (s *HMACSigner) Middleware() Middleware {
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+
+			r := req.Clone(req.Context())
+
+			if err := s.Sign(r); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+// Verify checks the signature & timestamp of an inbound request, the body is read and put back
+// A body over HMACConfig.MaxBodySize is rejected without being read further
+func (s *HMACSigner) Verify(r *http.Request) error {
+
+	got := r.Header.Get(s.cfg.Header)
+	if got == "" {
+		return fmt.Errorf("%w: no %s header", ErrSignatureInvalid, s.cfg.Header)
+	}
+
+	if s.cfg.KeyID != "" && r.Header.Get(s.cfg.KeyIDHeader) != s.cfg.KeyID {
+		return fmt.Errorf("%w: unknown key id %q", ErrSignatureInvalid, r.Header.Get(s.cfg.KeyIDHeader))
+	}
+
+	ts, err := strconv.ParseInt(r.Header.Get(s.cfg.TimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: bad %s header", ErrSignatureInvalid, s.cfg.TimestampHeader)
+	}
+
+	skew := time.Since(time.Unix(ts, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > s.cfg.MaxSkew {
+		return fmt.Errorf("%w: %s off", ErrSignatureExpired, skew.Round(time.Second))
+	}
+
+	if r.ContentLength > s.cfg.MaxBodySize {
+		return fmt.Errorf("%w: body over %d bytes", ErrSignatureInvalid, s.cfg.MaxBodySize)
+	}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(nil, r.Body, s.cfg.MaxBodySize)
+	}
+
+	body, err := readRequestBody(r)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("%w: body over %d bytes", ErrSignatureInvalid, s.cfg.MaxBodySize)
+		}
+		return err
+	}
+
+	if !hmac.Equal([]byte(got), []byte(s.signature(r, body))) {
+		return ErrSignatureInvalid
+	}
+
+	return nil
+}
+
+// VerifyHandler answers 401 to requests failing Verify, logged as errors to logName
+func (l *Utils) VerifyHandler(s *HMACSigner, logName string, next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if err := s.Verify(r); err != nil {
+
+			l.WriteCtx(r.Context(), logName, "error", fmt.Sprintf("Rejected request : %s, Method: %s, Path: %s, Remote: %s", err, r.Method, r.URL.Path, r.RemoteAddr))
+
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Canonical string of req, see HMACConfig.Template
+func (s *HMACSigner) canonical(req *http.Request, body []byte) string {
+
+	host := req.Host
+	if host == "" && req.URL != nil {
+		host = req.URL.Host
+	}
+
+	// An empty path is sent as "/"
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	out := hmacHeaderPlaceholder.ReplaceAllStringFunc(s.cfg.Template, func(m string) string {
+		return req.Header.Get(hmacHeaderPlaceholder.FindStringSubmatch(m)[1])
+	})
+
+	return strings.NewReplacer(
+		"{method}", req.Method,
+		"{path}", path,
+		"{query}", req.URL.RawQuery,
+		"{host}", host,
+		"{timestamp}", req.Header.Get(s.cfg.TimestampHeader),
+		"{body_hash}", s.digest(string(body)),
+		"{key_id}", s.cfg.KeyID,
+	).Replace(out)
+}
+
+func (s *HMACSigner) signature(req *http.Request, body []byte) string {
+
+	mac := s.mac(s.cfg.Secret, s.canonical(req, body))
+
+	if s.cfg.Base64 {
+		sum, _ := hex.DecodeString(mac)
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+
+	return mac
+}
+
+// Whole body of req, which can still be read afterwards
+func readRequestBody(req *http.Request) ([]byte, error) {
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	// A copy, keeping a streamed body streaming
+	if req.GetBody != nil {
+
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		return io.ReadAll(rc)
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return body, nil
+}
@@ -1,26 +1,26 @@
 package mylib
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net"
 	"net/http"
-	"net/http/httptrace"
-	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 )
 
 // HttpDial (string)
 func HttpDial(url string, t time.Duration) error {
-	timeout := t * time.Second
-	conn, err := net.DialTimeout("tcp", url, timeout)
+	return HttpDialCtx(context.Background(), url, t)
+}
+
+// HttpDialCtx, HttpDial giving up when ctx is done, t in second
+func HttpDialCtx(ctx context.Context, url string, t time.Duration) error {
+	dialer := net.Dialer{Timeout: t * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", url)
 	if err != nil {
+		err = wrapRequestError(ctx, err)
 		fmt.Printf("Site unreachable : %s, error: %#v\n", url, err)
 	} else {
 		defer conn.Close()
@@ -41,305 +41,127 @@ func HttpDial2(url string, t time.Duration) bool {
 }
 
 // HttpClient (time.Duration, time.Duration, bool)
+// Every call fails with the error ( see ErrTLSConfig ) when p.TLS is invalid
 func HttpClient(p PHttp) *http.Client {
-	//ref: Copy and modify defaults from https://golang.org/src/net/http/transport.go
-	//Note: Clients and Transports should only be created once and reused
-	transport := http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		Dial: (&net.Dialer{
-			// Modify the time to wait for a connection to establish
-			Timeout:   1 * time.Second,
-			KeepAlive: p.KeepAlive * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 10 * time.Second,
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
-		DisableKeepAlives:   p.IsDisableKeepAlive,
-		MaxIdleConns:        p.MaxIdleConns,
-		IdleConnTimeout:     p.IdleConnTimeout,
-		DisableCompression:  p.DisableCompression,
+
+	var rt http.RoundTripper
+
+	transport, err := newTransport(p)
+	if err != nil {
+		rt = errRoundTripper{err: err}
+	} else {
+		rt = transport
 	}
 
 	client := http.Client{
-		Transport: &transport,
+		Transport: Chain(rt, p.Middlewares...),
 		Timeout:   p.Timeout * time.Second,
 	}
 
 	return &client
 }
 
-func (l *Utils) Get(url string, headers map[string]string, transport PHttp) ([]byte, string, int, error) {
-
-	start := time.Now()
-
-	var (
-		respBody    []byte
-		errHttp     error
-		elapseInSec string
-		elapseInMS  string
-	)
-
-	httpClient := HttpClient(transport)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if len(headers) != 0 {
-		for k, v := range headers {
-
-			if k == "Basic-Auth" {
-				auth := strings.Split(v, ":")
-				req.SetBasicAuth(auth[0], auth[1])
-			} else {
-				req.Header.Set(k, v)
-			}
-		}
-	}
-	req.Close = true
-
-	if err != nil {
-		l.Write(l.LogName, "error",
-			fmt.Sprintf("Error Occured : %#v", err),
-		)
+// The transport is usable without its tls config when the error is not nil
+func newTransport(p PHttp) (*http.Transport, error) {
 
-		return []byte(""), "", 0, err
+	// Modify the time to wait for a connection to establish
+	dialTimeout := 1 * time.Second
+	if p.DialTimeout > 0 {
+		dialTimeout = p.DialTimeout * time.Second
 	}
 
-	var (
-		getConn   string
-		dnsStart  string
-		dnsDone   string
-		connStart string
-		connDone  string
-		gotConn   string
-	)
-
-	clientTrace := &httptrace.ClientTrace{
-		GetConn:  func(hostPort string) { getConn = fmt.Sprintf("Starting to create conn : [%s], ", hostPort) },
-		DNSStart: func(info httptrace.DNSStartInfo) { dnsStart = fmt.Sprintf("starting to look up dns : [%s], ", info) },
-		DNSDone:  func(info httptrace.DNSDoneInfo) { dnsDone = fmt.Sprintf("done looking up dns : [%#v], ", info) },
-		ConnectStart: func(network, addr string) {
-			connStart = fmt.Sprintf("starting tcp connection : [%s, %s], ", network, addr)
-		},
-		ConnectDone: func(network, addr string, err error) {
-			connDone = fmt.Sprintf("tcp connection created [%s, %s, %#v], ", network, addr, err)
-		},
-		GotConn: func(info httptrace.GotConnInfo) { gotConn = fmt.Sprintf("conn was reused: [%#v]", info) },
-	}
-	clientTraceCtx := httptrace.WithClientTrace(req.Context(), clientTrace)
-	req = req.WithContext(clientTraceCtx)
+	tlsConfig, err := newTLSConfig(p.TLS)
 
-	response, err := httpClient.Do(req)
-	if err != nil {
-
-		l.Write(l.LogName, "error",
-			fmt.Sprintf("Error sending request to API endpoint : %#v, Hit: %s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond, live trace : %s", err, url, string(respBody), response.Status, response.StatusCode, elapseInSec, elapseInMS, Concat(getConn, dnsStart, dnsDone, connStart, connDone, gotConn)),
-		)
-
-		return []byte(""), "", 0, err
-	}
-
-	// Close the connection to reuse it
-	defer response.Body.Close()
-
-	respBody, err = io.ReadAll(response.Body)
-	if err != nil {
-		l.Write(l.LogName, "error",
-			fmt.Sprintf("Couldn't parse response body : %#v", err),
-		)
-
-		l.Write(l.LogName, "error",
-			fmt.Sprintf("Couldn't parse response body : %#v, Hit: %s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond, live trace : %s", err, url, string(respBody), response.Status, response.StatusCode, elapseInSec, elapseInMS, Concat(getConn, dnsStart, dnsDone, connStart, connDone, gotConn)),
-		)
+	//ref: Copy and modify defaults from https://golang.org/src/net/http/transport.go
+	//Note: Clients and Transports should only be created once and reused, see NewClient
+	transport := http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: p.KeepAlive * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+		DisableKeepAlives:   p.IsDisableKeepAlive,
+		MaxIdleConns:        p.MaxIdleConns,
+		MaxIdleConnsPerHost: p.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     p.MaxConnsPerHost,
+		IdleConnTimeout:     p.IdleConnTimeout,
+		DisableCompression:  p.DisableCompression,
 	}
 
-	elapse := time.Since(start)
+	return &transport, err
+}
 
-	elapseInSec = fmt.Sprintf("%f", elapse.Seconds())
-	elapseInMS = strconv.FormatInt(elapse.Milliseconds(), 10)
+// Get builds a one shot client from transport, prefer NewClient for repeated calls
+func (l *Utils) Get(url string, headers map[string]string, transport PHttp) ([]byte, string, int, error) {
+	return l.GetCtx(context.Background(), url, headers, transport)
+}
 
-	l.Write(l.LogName, "info",
-		fmt.Sprintf("Hit: %s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond, live trace : %s", url, string(respBody), response.Status, response.StatusCode, elapseInSec, elapseInMS, Concat(getConn, dnsStart, dnsDone, connStart, connDone, gotConn)),
-	)
+// GetCtx, Get canceled when ctx is done ( see ErrRequestCanceled & ErrRequestTimeout )
+func (l *Utils) GetCtx(ctx context.Context, url string, headers map[string]string, transport PHttp) ([]byte, string, int, error) {
 
-	req = nil
-	httpClient = nil
+	c := l.oneShotClient(transport)
+	defer c.Close()
 
-	return respBody, response.Status, response.StatusCode, errHttp
+	return c.GetCtx(ctx, url, headers)
 }
 
+// Post builds a one shot client from transport, prefer NewClient for repeated calls
 func (l *Utils) Post(url string, headers map[string]string, body []byte, transport PHttp) ([]byte, string, int, error) {
+	return l.PostCtx(context.Background(), url, headers, body, transport)
+}
 
-	start := time.Now()
-
-	var (
-		respBody    []byte
-		elapseInSec string
-		elapseInMS  string
-	)
-
-	httpClient := HttpClient(transport)
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	//req.Header.Set("Content-Type", content_type)
-
-	if len(headers) != 0 {
-		for k, v := range headers {
+// PostCtx, Post canceled when ctx is done ( see ErrRequestCanceled & ErrRequestTimeout )
+func (l *Utils) PostCtx(ctx context.Context, url string, headers map[string]string, body []byte, transport PHttp) ([]byte, string, int, error) {
 
-			if k == "Basic-Auth" {
-				auth := strings.Split(v, ":")
-				req.SetBasicAuth(auth[0], auth[1])
-			} else {
-				req.Header.Set(k, v)
-			}
-		}
-	}
+	c := l.oneShotClient(transport)
+	defer c.Close()
 
-	req.Close = true
+	return c.PostCtx(ctx, url, headers, body)
+}
 
-	if err != nil {
-		l.Write(l.LogName, "error",
-			fmt.Sprintf("Error Occured : %#v", err),
-		)
+// Upload a file as the "file" multipart field through a one shot client built from transport,
+// prefer NewClient for repeated calls
+func (l *Utils) Upload(url string, headers map[string]string, extraParams map[string]string, filepath string, transport PHttp) ([]byte, string, int, error) {
+	return l.UploadCtx(context.Background(), url, headers, extraParams, filepath, transport)
+}
 
-		return []byte(""), "", 0, err
-	}
+// UploadCtx, Upload canceled when ctx is done ( see ErrRequestCanceled & ErrRequestTimeout )
+func (l *Utils) UploadCtx(ctx context.Context, url string, headers map[string]string, extraParams map[string]string, filepath string, transport PHttp) ([]byte, string, int, error) {
 
-	var (
-		getConn   string
-		dnsStart  string
-		dnsDone   string
-		connStart string
-		connDone  string
-		gotConn   string
-	)
-
-	clientTrace := &httptrace.ClientTrace{
-		GetConn:  func(hostPort string) { getConn = fmt.Sprintf("Starting to create conn : [%s], ", hostPort) },
-		DNSStart: func(info httptrace.DNSStartInfo) { dnsStart = fmt.Sprintf("starting to look up dns : [%s], ", info) },
-		DNSDone:  func(info httptrace.DNSDoneInfo) { dnsDone = fmt.Sprintf("done looking up dns : [%#v], ", info) },
-		ConnectStart: func(network, addr string) {
-			connStart = fmt.Sprintf("starting tcp connection : [%s, %s], ", network, addr)
-		},
-		ConnectDone: func(network, addr string, err error) {
-			connDone = fmt.Sprintf("tcp connection created [%s, %s, %#v], ", network, addr, err)
-		},
-		GotConn: func(info httptrace.GotConnInfo) { gotConn = fmt.Sprintf("conn was reused: [%#v]", info) },
-	}
-	clientTraceCtx := httptrace.WithClientTrace(req.Context(), clientTrace)
-	req = req.WithContext(clientTraceCtx)
+	c := l.oneShotClient(transport)
+	defer c.Close()
 
-	response, err := httpClient.Do(req)
-	if err != nil {
-
-		l.Write(l.LogName, "error",
-			fmt.Sprintf("Error sending request to API endpoint : %#v, Hit: %s, Request: %s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond, live trace : %s", err, url, string(body), string(respBody), response.Status, response.StatusCode, elapseInSec, elapseInMS, Concat(getConn, dnsStart, dnsDone, connStart, connDone, gotConn)),
-		)
-	}
+	return c.UploadCtx(ctx, url, headers, extraParams, filepath)
+}
 
-	// Close the connection to reuse it
-	defer response.Body.Close()
+// Build a request carrying the headers and the request id of ctx ( see InjectRequestID )
+func newRequest(ctx context.Context, method string, url string, body io.Reader, headers map[string]string) (*http.Request, error) {
 
-	respBody, err = io.ReadAll(response.Body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-
-		l.Write(l.LogName, "error",
-			fmt.Sprintf("Couldn't parse response body : %#v, Hit: %s, Request: %s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond, live trace : %s", err, url, string(body), string(respBody), response.Status, response.StatusCode, elapseInSec, elapseInMS, Concat(getConn, dnsStart, dnsDone, connStart, connDone, gotConn)),
-		)
-
-		return []byte(""), "", 0, err
+		return nil, err
 	}
 
-	elapse := time.Since(start)
+	setRequestHeaders(req, headers)
+	InjectRequestID(req)
 
-	elapseInSec = fmt.Sprintf("%f", elapse.Seconds())
-	elapseInMS = strconv.FormatInt(elapse.Milliseconds(), 10)
-
-	l.Write(l.LogName, "info",
-		fmt.Sprintf("Hit: %s, Request: %s, Response: %s, Status: %s, Status Code: %d, Elapse: %s second, %s milisecond, live trace : %s", url, string(body), string(respBody), response.Status, response.StatusCode, elapseInSec, elapseInMS, Concat(getConn, dnsStart, dnsDone, connStart, connDone, gotConn)),
-	)
-
-	req = nil
-	httpClient = nil
-
-	return respBody, response.Status, response.StatusCode, err
+	return req, nil
 }
 
-func (l *Utils) Upload(url string, headers map[string]string, extraParams map[string]string, filepath string, timeout time.Duration) {
-
-	req, err := l.newfileUploadRequest(url, extraParams, "file", filepath)
-	if err != nil {
-		l.Write(l.LogName, "error", fmt.Sprintf("Error writing tmp file : %v, URL : %s, filePath : %s", err, url, filepath))
-	}
+// Apply a headers map, the "Basic-Auth" key ( user:password ) sets basic authentication
+func setRequestHeaders(req *http.Request, headers map[string]string) {
 
-	if len(headers) != 0 {
-		for k, v := range headers {
+	for k, v := range headers {
 
-			if k == "Basic-Auth" {
-				auth := strings.Split(v, ":")
+		if k == "Basic-Auth" {
+			auth := strings.SplitN(v, ":", 2)
+			if len(auth) == 2 {
 				req.SetBasicAuth(auth[0], auth[1])
-			} else {
-				req.Header.Set(k, v)
 			}
+		} else {
+			req.Header.Set(k, v)
 		}
 	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		l.Write(l.LogName, "error", fmt.Sprintf("Error upload file : %v, URL : %s", err, url))
-	} else {
-		/* body := &bytes.Buffer{}
-		_, err := body.ReadFrom(resp.Body)
-		if err != nil {
-			l.Write("error", fmt.Sprintf("Error reading response : %v, URL : %s", err, url))
-		} */
-		//resp.Body.Close()
-
-		respBody, err := io.ReadAll(resp.Body)
-		if err != nil {
-			l.Write(l.LogName, "error",
-				fmt.Sprintf("Couldn't parse response body : %#v", err),
-			)
-		}
-		defer resp.Body.Close()
-
-		if err == nil {
-
-			if resp.StatusCode != 200 {
-				l.Write(l.LogName, "error", fmt.Sprintf("Failed upload, URL : %s, status : %d, header : %#v, response : %#v", url, resp.StatusCode, resp.Header, string(respBody)))
-			} else {
-				l.Write(l.LogName, "info", fmt.Sprintf("Success upload, URL : %s, status : %d, header : %#v, response : %#v", url, resp.StatusCode, resp.Header, string(respBody)))
-			}
-		}
-	}
-}
-
-func (l *Utils) newfileUploadRequest(uri string, params map[string]string, paramName, path string) (*http.Request, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		l.Write(l.LogName, "error", fmt.Sprintf("Failed open file : %v, path : %s", err, path))
-	}
-	defer file.Close()
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile(paramName, filepath.Base(path))
-	if err != nil {
-		l.Write(l.LogName, "error", fmt.Sprintf("Failed create form : %v, param name : %s, base_path : %s", err, paramName, filepath.Base(path)))
-		//return nil, err
-	}
-	_, err = io.Copy(part, file)
-
-	if err != nil {
-		l.Write(l.LogName, "error", fmt.Sprintf("Failed copy : %v, part : %#v, file : %#v", err, part, file))
-	}
-	for key, val := range params {
-		_ = writer.WriteField(key, val)
-	}
-	err = writer.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", uri, body)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	return req, err
 }
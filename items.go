@@ -1,6 +1,8 @@
 package mylib
 
 import (
+	"io"
+	"net/http"
 	"os"
 	"time"
 )
@@ -12,19 +14,169 @@ type (
 		LogLevelInit        int
 		LogName             string
 		LogFileName         string
-		LogOS               *os.File
+		LogOS               *os.File // file of LogName opened by SetUpLog, closed on day rollover & rotation ( see LogFile )
 		LogThread           string
 		AccessLogFormat     string
 		AccessLogTimeFormat string
 		TimeZone            string
+		LogFormat           string        // "text" (default) or "json"
+		LogMaxSize          int           // megabytes before a daily file is rotated, 0 = rotate by day only
+		LogMaxBackups       int           // rotated/old files kept per log name, 0 = keep all
+		LogMaxAge           int           // days rotated/old files are kept, 0 = keep all
+		LogCompress         bool          // gzip rotated and previous days files
+		LogAsync            bool          // queue lines to a background writer instead of writing inline, needs InitLog & Close
+		LogBufferSize       int           // queued lines when LogAsync, default 1024
+		LogOverflow         string        // "block" (default) or "drop" when the queue is full
+		LogFlushInterval    time.Duration // periodic flush when LogAsync, default 1 second
+		Redaction           Redaction     // secrets masked in what the HTTP helpers log
+		logSink             *logSink
+	}
+
+	Redaction struct {
+		Headers     []string // header names, case insensitive ( Authorization, Proxy-Authorization & Basic-Auth are always masked )
+		QueryParams []string // query string and form body parameter names
+		JSONPaths   []string // dotted paths in json bodies, "*" matches any key / index, a leading ".." matches at any depth
+		Patterns    []string // regular expressions, every match is masked
+		Mask        string   // replacement, default "***"
 	}
 
 	PHttp struct {
-		Timeout            time.Duration
-		KeepAlive          time.Duration
-		IsDisableKeepAlive bool
-		MaxIdleConns       int
-		IdleConnTimeout    time.Duration
-		DisableCompression bool
+		Timeout             time.Duration
+		KeepAlive           time.Duration
+		IsDisableKeepAlive  bool
+		MaxIdleConns        int
+		MaxIdleConnsPerHost int // default http.DefaultMaxIdleConnsPerHost (2)
+		MaxConnsPerHost     int // 0 = no limit
+		IdleConnTimeout     time.Duration
+		DisableCompression  bool
+		DialTimeout         time.Duration // second, default 1
+		Retry               RetryPolicy
+		Breaker             BreakerPolicy
+		RateLimits          []RateLimit // the first matching rule applies
+		TLS                 TLSConfig
+		Middlewares         []Middleware // the first one is the outermost, see Client.Use
+	}
+
+	// Wraps the round tripper of a client, see Client.Use
+	Middleware func(next http.RoundTripper) http.RoundTripper
+
+	// Progress of a transfer, total is -1 when unknown
+	ProgressFunc func(done int64, total int64)
+
+	// File part of a multipart upload
+	UploadFile struct {
+		Field       string                        // form field, default "file"
+		Path        string                        // file to send
+		Open        func() (io.ReadCloser, error) // instead of Path, called again for each attempt
+		Size        int64                         // of what Open returns, 0 = unknown ( the upload is then chunked )
+		Name        string                        // file name, default the base of Path
+		ContentType string                        // default application/octet-stream
+	}
+
+	DownloadOptions struct {
+		Checksum string       // "<algorithm>:<hex>" with md5, sha1, sha256 or sha512, checked before the rename
+		Progress ProgressFunc // bytes of the file written so far, resumed bytes included
+		Perm     os.FileMode  // of the new file, default 0644
+	}
+
+	// OAuth2 client credentials grant, see NewTokenSource
+	OAuth2Config struct {
+		TokenURL     string
+		ClientID     string
+		ClientSecret string
+		Scopes       []string
+		Audience     string            // sent as the "audience" parameter when set
+		AuthInParams bool              // send client_id / client_secret in the body instead of basic authentication
+		ExtraParams  map[string]string // added to the token request
+		ExpiryDelta  time.Duration     // refresh that long before the token expires, default 1 minute
+	}
+
+	// HMAC request signature, see NewHMACSigner
+	HMACConfig struct {
+		KeyID           string
+		Secret          string
+		Algorithm       string        // "sha256" (default), "sha512" or "sha1", also hashes the body
+		Template        string        // canonical string, default "{method}\n{path}\n{timestamp}\n{body_hash}"
+		Header          string        // signature header, default "X-Signature"
+		TimestampHeader string        // unix seconds, default "X-Timestamp"
+		KeyIDHeader     string        // sent when KeyID is set, default "X-Key-Id"
+		Base64          bool          // base64 signature instead of hex
+		MaxSkew         time.Duration // accepted clock difference when verifying, default 5 minutes
+		MaxBodySize     int64         // bytes of an inbound body read by Verify, default 10 MB
+	}
+
+	// Record / replay of HTTP calls for tests, see NewCassette
+	CassetteConfig struct {
+		Path              string    // json file of the interactions
+		Mode              string    // CassetteAuto (default), CassetteRecord or CassetteReplay
+		MatchBody         bool      // the request body must match too
+		MatchHeaders      bool      // the saved request headers must match too
+		IgnoreHeaders     []string  // neither saved nor matched ( User-Agent, Content-Length & the request id header always are )
+		IgnoreQueryParams []string  // left out when matching urls, e.g. a timestamp or a nonce
+		Redaction         Redaction // applied to urls, headers & bodies before saving, and to live requests before matching
+	}
+
+	// Certificates are verified unless InsecureSkipVerify
+	TLSConfig struct {
+		InsecureSkipVerify bool             // skip certificate verification, for tests only
+		RootCAFiles        []string         // PEM bundles trusted instead of the system roots
+		RootCAPEM          []byte           // PEM bundle trusted instead of the system roots
+		SystemRoots        bool             // trust the system roots along with the custom ones
+		Certificates       []TLSCertificate // client certificates for mutual TLS
+		MinVersion         uint16           // e.g. tls.VersionTLS13, default tls.VersionTLS12
+		ServerName         string           // SNI & verified name, default the host of the url
+		PinnedSPKI         []string         // base64 SHA-256 of the SubjectPublicKeyInfo, one of the chain must match
+	}
+
+	// Client certificate & key, from files or PEM
+	TLSCertificate struct {
+		CertFile string
+		KeyFile  string
+		CertPEM  []byte
+		KeyPEM   []byte
+	}
+
+	// Durations of a RetryPolicy are plain durations ( e.g. 200 * time.Millisecond )
+	RetryPolicy struct {
+		MaxAttempts        int           // attempts including the first one, 0 or 1 = no retry
+		BackoffBase        time.Duration // delay before the second attempt, doubled each time, default 100ms
+		BackoffCap         time.Duration // longest delay, default 10s
+		Jitter             bool          // "full jitter" : random delay between 0 and the backoff
+		RetryOnStatus      []int         // default 429, 502, 503 & 504
+		RespectRetryAfter  bool          // wait what the Retry-After header says ( up to BackoffCap )
+		RetryNonIdempotent bool          // retry POST / PATCH too, otherwise only with an Idempotency-Key header
+	}
+
+	// Circuit breaker kept per host, a failure is a transport error or a 5xx status
+	BreakerPolicy struct {
+		ConsecutiveFailures int           // open after that many failures in a row, 0 = not used
+		FailureRatio        float64       // open when failures / requests reaches it within Window, 0 = not used
+		MinRequests         int           // requests within Window before FailureRatio applies, default 10
+		Window              time.Duration // window of FailureRatio, default 1 minute
+		CoolDown            time.Duration // time open before letting trial requests through, default 30s
+		HalfOpenRequests    int           // concurrent trial requests while half-open, default 1
+	}
+
+	// Token bucket limiting calls to a host or to urls under a prefix
+	RateLimit struct {
+		Host     string  // host[:port] as in the url, used when Prefix is empty
+		Prefix   string  // url prefix, e.g. "https://api.example.com/v1/sms"
+		Rate     float64 // requests per second
+		Burst    int     // bucket size, default 1
+		FailFast bool    // return ErrRateLimited instead of waiting for a token
+	}
+
+	SOAPOptions struct {
+		Version  string        // SOAP11 (default) or SOAP12
+		Security *WSSecurity   // adds a WS-Security UsernameToken header
+		Headers  []interface{} // extra soap:Header blocks, marshalled with encoding/xml ( []byte is sent as is )
+	}
+
+	// WS-Security UsernameToken
+	WSSecurity struct {
+		Username       string
+		Password       string
+		PasswordType   string // WSSPasswordText (default) or WSSPasswordDigest
+		MustUnderstand bool
 	}
 )
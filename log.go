@@ -1,10 +1,14 @@
 package mylib
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
-	"io/fs"
-	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Instance for log setup method
@@ -24,6 +28,20 @@ func InitLog(Log Utils) *Utils {
 	l.LogPath = Log.LogPath
 	l.LogLevelInit = Log.LogLevelInit
 	l.TimeZone = Log.TimeZone
+	l.LogFormat = Log.LogFormat
+	l.LogMaxSize = Log.LogMaxSize
+	l.LogMaxBackups = Log.LogMaxBackups
+	l.LogMaxAge = Log.LogMaxAge
+	l.LogCompress = Log.LogCompress
+	l.LogAsync = Log.LogAsync
+	l.LogBufferSize = Log.LogBufferSize
+	l.LogOverflow = Log.LogOverflow
+	l.LogFlushInterval = Log.LogFlushInterval
+	l.Redaction = Log.Redaction
+
+	if l.LogAsync {
+		l.logSink = newLogSink(&l)
+	}
 
 	os.Setenv("TZ", Log.TimeZone)
 
@@ -34,19 +52,22 @@ func (l *Utils) SetUpLog(Log Utils) {
 	l.LogThread = Log.LogThread + " "
 	l.LogName = Log.LogName
 
-	fullPathLog := l.GetStringPathLog(l.LogName)
-	f, err := os.OpenFile(fullPathLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777)
-	if err != nil {
-		log.Println(err)
-	}
-	l.LogOS = f
-	l.LogOS.Chmod(fs.ModePerm)
-	os.Chmod(fullPathLog, 0777)
+	// LogOS is the file of today, see LogFile for the current one
+	l.LogFileName = l.GetFormatTime("20060102")
+	l.LogOS = l.logDir(l.LogName).open(l, l.LogFileName)
 }
 
 // Used to define a full path of a log
 func (l *Utils) GetStringPathLog(logName string) string {
 
+	// Return log path with modify full path
+	l.LogFileName = l.GetFormatTime("20060102")
+	return l.pathLog(logName, l.LogFileName)
+}
+
+// Full path of a log for a given day (20060102), creating the log directory
+func (l *Utils) pathLog(logName string, day string) string {
+
 	modLogPath := l.LogPath + "/" + logName
 
 	//fmt.Println("logpath : " + logpath)
@@ -56,9 +77,7 @@ func (l *Utils) GetStringPathLog(logName string) string {
 		_ = os.Mkdir(modLogPath, 0777)
 	}
 
-	// Return log path with modify full path
-	l.LogFileName = l.GetFormatTime("20060102")
-	return modLogPath + "/" + l.LogFileName + ".log"
+	return modLogPath + "/" + day + ".log"
 }
 
 // Write method
@@ -66,88 +85,173 @@ func (l *Utils) GetStringPathLog(logName string) string {
 // 1. @loglevel ( option : 'info', 'debug', & 'error' ) -> string
 // 2. @logMsg ( a message string appear in a log file ) -> string
 func (l *Utils) Write(logName string, logLevel string, logMsg string) {
+	l.WriteWithFields(logName, logLevel, logMsg, nil)
+}
+
+// WriteWithFields method, same as Write with extra key/value pairs
+// param :
+// 1. @loglevel ( option : 'info', 'debug', & 'error' ) -> string
+// 2. @logMsg ( a message string appear in a log file ) -> string
+// 3. @fields ( appended as key=value in text mode or as members of the json object ) -> map[string]interface{}
+func (l *Utils) WriteWithFields(logName string, logLevel string, logMsg string, fields map[string]interface{}) {
+	l.write(time.Now(), l.LogThread, logName, logLevel, logMsg, fields)
+}
+
+// Route a line stamped at to the "error" log or to the log name depending on its level
+func (l *Utils) write(at time.Time, thread string, logName string, logLevel string, logMsg string, fields map[string]interface{}) {
 
-	var (
-		level        int
-		allowLogging bool
-	)
+	level := parseLogLevel(logLevel)
+	allowLogging := l.isLevelAllowed(level)
 
-	// Parsing loglevel
+	if level == 3 {
+
+		allowLogging = false
+
+		l.writeLog("error", l.formatLine(at, thread, logName, logLevel, logMsg, fields))
+
+		fmt.Println(logMsg)
+	}
+
+	if allowLogging {
+
+		l.writeLog(logName, l.formatLine(at, thread, logName, logLevel, logMsg, fields))
+
+		fmt.Println(logMsg)
+	}
+}
+
+// Parsing loglevel : 1 = info, 2 = debug, 3 = error, 0 = unknown
+func parseLogLevel(logLevel string) int {
 
 	if logLevel == "info" {
-		level = 1
+		return 1
 	} else if logLevel == "debug" {
-		level = 2
+		return 2
 	} else if logLevel == "error" {
-		level = 3
+		return 3
 	}
 
+	return 0
+}
+
+// Whether a parsed level passes LogLevelInit for the main log
+// (errors are routed to the "error" log separately)
+func (l *Utils) isLevelAllowed(level int) bool {
+
 	if l.LogLevelInit == 0 || l.LogLevelInit > 2 {
 
-		allowLogging = true
+		return true
 
 	} else if l.LogLevelInit == 1 {
 
-		if level == 1 {
-			allowLogging = true
-		} else {
-			allowLogging = false
-		}
+		return level == 1
 
 	} else if l.LogLevelInit == 2 {
 
-		if level == 1 || level == 2 {
-			allowLogging = true
-		} else {
-			allowLogging = false
-		}
+		return level == 1 || level == 2
+	}
 
-	} else {
+	return false
+}
 
-		allowLogging = false
+// Format a single log line in the configured LogFormat
+func (l *Utils) formatLine(at time.Time, thread string, logName string, logLevel string, logMsg string, fields map[string]interface{}) []byte {
+
+	if l.LogFormat == "json" {
+		return l.formatJSONLine(at, thread, logName, logLevel, logMsg, fields)
 	}
 
-	if level == 3 {
+	threadlogging := thread + " " + l.formatTime(at, "2006-01-02 15:04:05")
 
-		allowLogging = false
+	return []byte(threadlogging + " " + logLevel + " - " + logMsg + formatTextFields(fields) + "\n")
+}
 
-		fullPathLog := l.GetStringPathLog("error")
-		f, err := os.OpenFile(fullPathLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777)
-		if err != nil {
-			log.Println(err)
+// Build one json object per line : time, level, thread, log, msg followed by the extra fields sorted by key
+func (l *Utils) formatJSONLine(at time.Time, thread string, logName string, logLevel string, logMsg string, fields map[string]interface{}) []byte {
+
+	var b bytes.Buffer
+
+	b.WriteByte('{')
+	writeJSONMember(&b, "time", l.formatTime(at, "2006-01-02T15:04:05.000Z07:00"), true)
+	writeJSONMember(&b, "level", logLevel, false)
+	writeJSONMember(&b, "thread", strings.TrimSpace(thread), false)
+	writeJSONMember(&b, "log", logName, false)
+	writeJSONMember(&b, "msg", logMsg, false)
+
+	for _, k := range sortedFieldKeys(fields) {
+
+		key := k
+		// Never let a field shadow one of the fixed members
+		if key == "time" || key == "level" || key == "thread" || key == "log" || key == "msg" {
+			key = "_" + key
 		}
-		f.Chmod(fs.ModePerm)
-		os.Chmod(fullPathLog, 0777)
 
-		threadlogging := l.LogThread + " " + l.GetFormatTime("2006-01-02 15:04:05")
+		writeJSONMember(&b, key, fields[k], false)
+	}
 
-		logger := log.New(f, threadlogging, 0)
-		logger.Println(" " + logLevel + " - " + logMsg)
+	b.WriteString("}\n")
 
-		defer f.Close()
+	return b.Bytes()
+}
 
-		fmt.Println(logMsg)
+// GetFormatTime for a given time instead of now
+func (l *Utils) formatTime(t time.Time, layout string) string {
+
+	loc, _ := time.LoadLocation(l.TimeZone)
+
+	return t.In(loc).Format(layout)
+}
+
+func writeJSONMember(b *bytes.Buffer, key string, value interface{}, first bool) {
+
+	if !first {
+		b.WriteByte(',')
 	}
 
-	if allowLogging {
+	k, _ := json.Marshal(key)
+	b.Write(k)
+	b.WriteByte(':')
+
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprintf("%v", value))
+	}
+	b.Write(v)
+}
+
+// Render fields as " key=value" pairs, quoting values with spaces
+func formatTextFields(fields map[string]interface{}) string {
 
-		if l.LogFileName != l.GetFormatTime("20060102") {
+	if len(fields) == 0 {
+		return ""
+	}
 
-			l = InitLog(Utils{
-				LogPath:      l.LogPath,
-				LogLevelInit: l.LogLevelInit,
-				TimeZone:     l.TimeZone,
-			})
-			l.SetUpLog(Utils{LogThread: l.GetUniqId(), LogName: logName})
+	var b strings.Builder
 
-			l.LogFileName = l.GetFormatTime("20060102")
+	for _, k := range sortedFieldKeys(fields) {
+
+		v := fmt.Sprintf("%v", fields[k])
+		if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+			v = strconv.Quote(v)
 		}
 
-		threadlogging := l.LogThread + " " + l.GetFormatTime("2006-01-02 15:04:05")
+		b.WriteString(" " + k + "=" + v)
+	}
 
-		logger := log.New(l.LogOS, threadlogging, 0)
-		logger.Println(" " + logLevel + " - " + logMsg)
+	return b.String()
+}
 
-		fmt.Println(logMsg)
+func sortedFieldKeys(fields map[string]interface{}) []string {
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+
+	return keys
 }
@@ -0,0 +1,141 @@
+package mylib
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Header carrying the request / correlation id between services
+var RequestIDHeader = "X-Request-Id"
+
+type logCtxKey int
+
+const (
+	requestIDKey logCtxKey = iota
+	logFieldsKey
+)
+
+// Returns a copy of ctx carrying a request / correlation id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// Request / correlation id stored by WithRequestID, empty when none
+func RequestIDFromContext(ctx context.Context) string {
+
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDKey).(string)
+
+	return id
+}
+
+// Returns a copy of ctx carrying extra log fields, merged with the ones already in ctx
+func WithLogFields(ctx context.Context, fields map[string]interface{}) context.Context {
+
+	merged := make(map[string]interface{})
+	for k, v := range LogFieldsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, logFieldsKey, merged)
+}
+
+// Log fields stored by WithLogFields, nil when none
+func LogFieldsFromContext(ctx context.Context) map[string]interface{} {
+
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(logFieldsKey).(map[string]interface{})
+
+	return fields
+}
+
+// WriteCtx method, same as Write but the request id of ctx replaces LogThread
+// and the fields of ctx are appended to the line
+// param :
+// 1. @ctx ( see WithRequestID & WithLogFields ) -> context.Context
+// 2. @loglevel ( option : 'info', 'debug', & 'error' ) -> string
+// 3. @logMsg ( a message string appear in a log file ) -> string
+func (l *Utils) WriteCtx(ctx context.Context, logName string, logLevel string, logMsg string) {
+	l.WriteCtxWithFields(ctx, logName, logLevel, logMsg, nil)
+}
+
+// WriteCtxWithFields method, WriteCtx with extra key/value pairs ( taking precedence over the ctx ones )
+func (l *Utils) WriteCtxWithFields(ctx context.Context, logName string, logLevel string, logMsg string, fields map[string]interface{}) {
+	l.writeCtx(ctx, time.Now(), logName, logLevel, logMsg, fields)
+}
+
+// WriteCtxWithFields for a line stamped at
+func (l *Utils) writeCtx(ctx context.Context, at time.Time, logName string, logLevel string, logMsg string, fields map[string]interface{}) {
+
+	thread := l.LogThread
+	if id := RequestIDFromContext(ctx); id != "" {
+		thread = id + " "
+	}
+
+	if ctxFields := LogFieldsFromContext(ctx); len(ctxFields) != 0 {
+
+		merged := make(map[string]interface{}, len(ctxFields)+len(fields))
+		for k, v := range ctxFields {
+			merged[k] = v
+		}
+		for k, v := range fields {
+			merged[k] = v
+		}
+
+		fields = merged
+	}
+
+	l.write(at, thread, logName, logLevel, logMsg, fields)
+}
+
+// Sets RequestIDHeader on an outgoing request from its context, unless already set
+func InjectRequestID(req *http.Request) {
+
+	if req.Header.Get(RequestIDHeader) != "" {
+		return
+	}
+
+	if id := RequestIDFromContext(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
+
+// Request id of an incoming request : its context first, then RequestIDHeader
+func ExtractRequestID(r *http.Request) string {
+
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+
+	return r.Header.Get(RequestIDHeader)
+}
+
+// RequestID middleware, takes the id from RequestIDHeader (or generates one with GetUniqId),
+// stores it in the request context for WriteCtx / the HTTP helpers and echoes it in the response
+func (l *Utils) RequestID(next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := ExtractRequestID(r)
+		if id == "" {
+			id = l.GetUniqId()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		// Keep the header in sync so access logs with %{X-Request-Id}i see generated ids too
+		r.Header.Set(RequestIDHeader, id)
+
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
@@ -0,0 +1,431 @@
+package mylib
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Log directories ( LogPath/<log name> ) open in the process, keyed by absolute path
+// Every Utils writing to a directory goes through its single logDir, the only one
+// rotating, compressing & pruning the files there
+var (
+	logDirs       sync.Map // absolute path -> *logDir
+	logDirAliases sync.Map // LogPath + "/" + log name -> *logDir
+)
+
+// logDir owns the current file of a log directory
+type logDir struct {
+	name string
+	dir  string
+
+	mu   sync.Mutex
+	f    *os.File
+	day  string // never goes back, a late line of a previous day goes to the current file
+	size int64
+
+	cleanMu sync.Mutex     // one cleanup of the directory at a time
+	cleanWG sync.WaitGroup // running & pending cleanups
+}
+
+// logSink queues the lines of a Utils to a background writer, created by InitLog
+// for LogAsync only ( the files themselves are owned by the shared logDir )
+type logSink struct {
+	l *Utils
+
+	qmu      sync.RWMutex
+	queue    chan sinkEntry
+	flushReq chan chan struct{}
+	done     chan struct{}
+	closed   bool
+	dropped  uint64
+}
+
+type sinkEntry struct {
+	d    *logDir
+	day  string
+	line []byte
+}
+
+// Lines of a directory waiting for the next flush of the background writer
+type sinkBatch struct {
+	day string
+	buf bytes.Buffer
+}
+
+// Written at once by the background writer past this size
+const sinkBatchSize = 64 << 10
+
+func newLogSink(l *Utils) *logSink {
+
+	size := l.LogBufferSize
+	if size <= 0 {
+		size = 1024
+	}
+
+	interval := l.LogFlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	s := &logSink{
+		l:        l,
+		queue:    make(chan sinkEntry, size),
+		flushReq: make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go s.run(interval)
+
+	return s
+}
+
+// Shared owner of the directory of a log name
+func (l *Utils) logDir(logName string) *logDir {
+
+	alias := l.LogPath + "/" + logName
+	if d, ok := logDirAliases.Load(alias); ok {
+		return d.(*logDir)
+	}
+
+	dir, err := filepath.Abs(alias)
+	if err != nil {
+		dir = filepath.Clean(alias)
+	}
+
+	d, _ := logDirs.LoadOrStore(dir, &logDir{name: logName, dir: dir})
+	logDirAliases.Store(alias, d)
+
+	return d.(*logDir)
+}
+
+// Queue or write a formatted line into the current file of a log name
+func (l *Utils) writeLog(logName string, line []byte) {
+
+	e := sinkEntry{d: l.logDir(logName), day: l.GetFormatTime("20060102"), line: line}
+
+	if s := l.logSink; s != nil && s.enqueue(e) {
+		return
+	}
+
+	e.d.write(l, e.day, e.line)
+}
+
+// Queue e for the background writer, false when the line is to be written inline
+func (s *logSink) enqueue(e sinkEntry) bool {
+
+	s.qmu.RLock()
+	defer s.qmu.RUnlock()
+
+	// Closed, fall back to writing inline
+	if s.closed {
+		return false
+	}
+
+	if s.l.LogOverflow == "drop" {
+		select {
+		case s.queue <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	} else {
+		s.queue <- e
+	}
+
+	return true
+}
+
+// Write lines stamped day, rotating the file once it reached the LogMaxSize of l
+func (d *logDir) write(l *Utils, day string, lines []byte) {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.current(l, day) == nil {
+		return
+	}
+
+	if l.LogMaxSize > 0 && d.size >= int64(l.LogMaxSize)*1024*1024 {
+
+		d.rotate(l)
+		if d.f == nil {
+			return
+		}
+	}
+
+	n, err := d.f.Write(lines)
+	if err != nil {
+		log.Println(err)
+	}
+
+	d.size += int64(n)
+}
+
+// Open the file of day, returns the underlying *os.File
+func (d *logDir) open(l *Utils, day string) *os.File {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.current(l, day)
+}
+
+// File of day ( or of a later day already open ), must be called with d.mu held
+func (d *logDir) current(l *Utils, day string) *os.File {
+
+	if day < d.day {
+		day = d.day
+	}
+
+	if d.f != nil && day == d.day {
+		return d.f
+	}
+
+	if d.f != nil {
+		d.f.Close()
+		d.f = nil
+	}
+
+	path := l.pathLog(d.name, day)
+	created := !fileExists(path)
+
+	d.f = openLogFile(path)
+	if d.f == nil {
+		return nil
+	}
+
+	d.day = day
+	d.size = 0
+	if st, err := d.f.Stat(); err == nil {
+		d.size = st.Size()
+	}
+
+	// A new daily file, the previous days can be compressed / pruned
+	if created {
+		d.cleanup(l)
+	}
+
+	return d.f
+}
+
+// Move the current file aside and reopen it, must be called with d.mu held
+func (d *logDir) rotate(l *Utils) {
+
+	path := d.f.Name()
+
+	d.f.Close()
+	d.f = nil
+
+	if err := rotateFile(path); err != nil {
+		log.Println(err)
+	}
+
+	d.f = openLogFile(path)
+	if d.f == nil {
+		return
+	}
+
+	d.size = 0
+	if st, err := d.f.Stat(); err == nil {
+		d.size = st.Size()
+	}
+
+	d.cleanup(l)
+}
+
+// Compress & prune the inactive files in the background, must be called with d.mu held
+func (d *logDir) cleanup(l *Utils) {
+
+	if !l.LogCompress && l.LogMaxBackups <= 0 && l.LogMaxAge <= 0 {
+		return
+	}
+
+	day := d.day
+
+	d.cleanWG.Add(1)
+
+	go func() {
+		defer d.cleanWG.Done()
+
+		d.cleanMu.Lock()
+		defer d.cleanMu.Unlock()
+
+		l.cleanupLogs(d.dir, day)
+	}()
+}
+
+// Close the current file & wait for the cleanups, the next write reopens it
+func (d *logDir) close() {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.f != nil {
+		d.f.Close()
+		d.f = nil
+	}
+
+	d.cleanWG.Wait()
+}
+
+// Background writer of the async mode, lines are batched per directory
+func (s *logSink) run(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	pending := make(map[*logDir]*sinkBatch)
+
+	add := func(e sinkEntry) {
+
+		b := pending[e.d]
+		if b == nil {
+			b = &sinkBatch{}
+			pending[e.d] = b
+		}
+
+		if b.buf.Len() != 0 && b.day != e.day {
+			e.d.write(s.l, b.day, b.buf.Bytes())
+			b.buf.Reset()
+		}
+
+		b.day = e.day
+		b.buf.Write(e.line)
+
+		if b.buf.Len() >= sinkBatchSize {
+			e.d.write(s.l, b.day, b.buf.Bytes())
+			b.buf.Reset()
+		}
+	}
+
+	flush := func() {
+		for d, b := range pending {
+			if b.buf.Len() != 0 {
+				d.write(s.l, b.day, b.buf.Bytes())
+			}
+			delete(pending, d)
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-s.queue:
+
+			if !ok {
+				flush()
+				close(s.done)
+				return
+			}
+
+			add(e)
+
+		case <-ticker.C:
+
+			flush()
+
+		case ack := <-s.flushReq:
+
+			// Everything queued so far
+			for drained := false; !drained; {
+				select {
+				case e, ok := <-s.queue:
+					if ok {
+						add(e)
+					} else {
+						drained = true
+					}
+				default:
+					drained = true
+				}
+			}
+
+			flush()
+
+			close(ack)
+		}
+	}
+}
+
+// LogFile method
+// Current file of LogName, nil before SetUpLog or after Close
+// Prefer it to LogOS, the file is replaced on day rollover and size rotation ( LogMaxSize )
+func (l *Utils) LogFile() *os.File {
+
+	d := l.logDir(l.LogName)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.f
+}
+
+// Flush method
+// Writes every queued log line (LogAsync), the files are not buffered otherwise
+func (l *Utils) Flush() {
+
+	s := l.logSink
+	if s == nil {
+		return
+	}
+
+	s.qmu.RLock()
+	closed := s.closed
+	s.qmu.RUnlock()
+
+	if closed {
+		return
+	}
+
+	ack := make(chan struct{})
+
+	select {
+	case s.flushReq <- ack:
+		<-ack
+	case <-s.done:
+	}
+}
+
+// Close method, to be called on shutdown
+// Drains the queue (LogAsync), stops the background writer, closes the log files of LogPath
+// and waits for their compression / pruning
+// Logging after Close reopens the files and writes inline, so do other Utils sharing LogPath
+func (l *Utils) Close() {
+
+	if s := l.logSink; s != nil {
+
+		s.qmu.Lock()
+		if !s.closed {
+			s.closed = true
+			close(s.queue)
+		}
+		s.qmu.Unlock()
+
+		<-s.done
+	}
+
+	root, err := filepath.Abs(l.LogPath)
+	if err != nil {
+		root = filepath.Clean(l.LogPath)
+	}
+
+	logDirs.Range(func(k, v interface{}) bool {
+		if strings.HasPrefix(k.(string), root+string(filepath.Separator)) {
+			v.(*logDir).close()
+		}
+		return true
+	})
+}
+
+// Number of log lines dropped because the async queue was full ( LogOverflow : "drop" )
+func (l *Utils) DroppedLogs() uint64 {
+	if l.logSink == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&l.logSink.dropped)
+}
@@ -0,0 +1,161 @@
+package mylib
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Lines of every file of a log directory, the compressed ones included
+func readLogDir(t *testing.T, dir string) (lines []string, names []string) {
+
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entries {
+
+		names = append(names, e.Name())
+
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var r io.Reader = f
+		if strings.HasSuffix(e.Name(), ".gz") {
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				t.Fatalf("%s : %s", e.Name(), err)
+			}
+			r = zr
+		}
+
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64<<10), 64<<10)
+		for sc.Scan() {
+			lines = append(lines, sc.Text())
+		}
+		if err := sc.Err(); err != nil {
+			t.Fatalf("%s : %s", e.Name(), err)
+		}
+
+		f.Close()
+	}
+
+	return lines, names
+}
+
+// Writes every line once, from every writer, across the rotated & compressed files
+func assertLogLines(t *testing.T, dir string, writers int, perWriter int) {
+
+	t.Helper()
+
+	lines, names := readLogDir(t, dir)
+
+	seen := make(map[string]int)
+	for _, line := range lines {
+		seen[strings.SplitN(line, " ", 2)[0]]++
+	}
+
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			if id := fmt.Sprintf("w%d-%d", w, i); seen[id] != 1 {
+				t.Fatalf("%s written %d times, files %v", id, seen[id], names)
+			}
+		}
+	}
+
+	if len(lines) != writers*perWriter {
+		t.Fatalf("%d lines, expected %d, files %v", len(lines), writers*perWriter, names)
+	}
+}
+
+// Two Utils sharing a log name must not rotate or compress each other's files away
+func TestLogRotationSharedBetweenUtils(t *testing.T) {
+
+	dir := t.TempDir()
+
+	const (
+		writers   = 6
+		perWriter = 1000
+	)
+
+	utils := []*Utils{
+		InitLog(Utils{LogPath: dir, LogMaxSize: 1, LogCompress: true}),
+		InitLog(Utils{LogPath: dir + "/", LogMaxSize: 1, LogCompress: true, LogAsync: true}),
+	}
+
+	pad := strings.Repeat("x", 1024)
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+
+		wg.Add(1)
+		go func(w int, l *Utils) {
+			defer wg.Done()
+
+			for i := 0; i < perWriter; i++ {
+				l.writeLog("app", []byte(fmt.Sprintf("w%d-%d %s\n", w, i, pad)))
+			}
+		}(w, utils[w%len(utils)])
+	}
+	wg.Wait()
+
+	for _, l := range utils {
+		l.Close()
+	}
+
+	assertLogLines(t, filepath.Join(dir, "app"), writers, perWriter)
+
+	_, names := readLogDir(t, filepath.Join(dir, "app"))
+
+	var rotated int
+	for _, name := range names {
+		if strings.HasSuffix(name, ".tmp") {
+			t.Fatalf("temporary file left : %v", names)
+		}
+		if strings.HasSuffix(name, ".gz") {
+			rotated++
+		}
+	}
+	if rotated < 4 || rotated != len(names)-1 {
+		t.Fatalf("expected the rotated files compressed, got %v", names)
+	}
+}
+
+// Logging after Close reopens the files
+func TestLogWriteAfterClose(t *testing.T) {
+
+	dir := t.TempDir()
+
+	l := InitLog(Utils{LogPath: dir, LogAsync: true})
+	l.SetUpLog(Utils{LogName: "app"})
+
+	l.writeLog("app", []byte("w0-0 before\n"))
+	l.Flush()
+
+	if l.LogFile() == nil {
+		t.Fatal("no current file after SetUpLog")
+	}
+
+	l.Close()
+
+	if l.LogFile() != nil {
+		t.Fatal("current file still open after Close")
+	}
+
+	l.writeLog("app", []byte("w0-1 after\n"))
+	l.Close()
+
+	assertLogLines(t, filepath.Join(dir, "app"), 1, 2)
+}
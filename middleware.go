@@ -0,0 +1,51 @@
+package mylib
+
+import (
+	"net/http"
+)
+
+// RoundTripperFunc turns a function into an http.RoundTripper, handy to write a Middleware
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Chain wraps rt with middlewares, the first one sees the request first and the response last
+func Chain(rt http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		if middlewares[i] != nil {
+			rt = middlewares[i](rt)
+		}
+	}
+
+	return rt
+}
+
+// Use adds middlewares inside the ones already set ( PHttp.Middlewares first ),
+// call it before the client is shared between goroutines
+//
+// Every attempt of a retried call goes through the chain, the request carries the
+// context of the call ( see RequestIDFromContext ) and must be cloned before being modified
+func (c *Client) Use(middlewares ...Middleware) *Client {
+
+	c.middlewares = append(c.middlewares, middlewares...)
+	c.http.Transport = Chain(c.base, c.middlewares...)
+
+	return c
+}
+
+// HeadersMiddleware sets headers on every request, replacing the ones of the call
+func HeadersMiddleware(headers map[string]string) Middleware {
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+
+			req = req.Clone(req.Context())
+			setRequestHeaders(req, headers)
+
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,572 @@
+// Package mylibtest is a programmable fake HTTP server to test code calling
+// the mylib HTTP helpers offline : route stubs, canned JSON / XML / SOAP
+// responses, latency, faults and assertions on the requests received
+package mylibtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wiliehidayat87/mylib/v2"
+)
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// Server fake server, unmatched requests get a 404 and are kept for AssertNoUnmatched
+type Server struct {
+	*httptest.Server
+
+	t testing.TB
+
+	mu        sync.Mutex
+	routes    []*Route
+	requests  []Request
+	unmatched []Request
+}
+
+// Request as received by the server
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+	Time   time.Time
+}
+
+// Route stub of a method & path, answering with its steps in order, the last one repeating
+type Route struct {
+	s      *Server
+	method string
+	path   string
+	steps  []*step
+	calls  int
+}
+
+type step struct {
+	status  int
+	header  http.Header
+	body    []byte
+	delay   time.Duration
+	chunk   int
+	every   time.Duration
+	reset   bool
+	handler http.HandlerFunc
+}
+
+// NewServer started fake server, closed when t ends, stub errors are reported to t
+func NewServer(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// NewTLSServer fake https server, trust it with CAPEM in PHttp.TLS.RootCAPEM
+func NewTLSServer(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// CAPEM certificate of a TLS server, PEM encoded
+func (s *Server) CAPEM() []byte {
+
+	if s.Certificate() == nil {
+		return nil
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+}
+
+// Addr host:port of the server, for HttpDial
+func (s *Server) Addr() string {
+	return s.Listener.Addr().String()
+}
+
+// Handle stub for method ( "" or "*" = any ) & path ( a trailing "*" matches any suffix ),
+// the latest stub of a request wins
+func (s *Server) Handle(method string, path string) *Route {
+
+	r := &Route{s: s, method: strings.ToUpper(method), path: path}
+
+	s.mu.Lock()
+	s.routes = append(s.routes, r)
+	s.mu.Unlock()
+
+	return r
+}
+
+// Requests received so far, matched or not
+func (s *Server) Requests() []Request {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsTo received requests matching method & path the way Handle does
+func (s *Server) RequestsTo(method string, path string) []Request {
+
+	probe := &Route{method: strings.ToUpper(method), path: path}
+
+	var out []Request
+	for _, r := range s.Requests() {
+		if probe.matches(r.Method, r.Path) {
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// Reset forgets the routes & the requests received
+func (s *Server) Reset() {
+
+	s.mu.Lock()
+	s.routes = nil
+	s.requests = nil
+	s.unmatched = nil
+	s.mu.Unlock()
+}
+
+// AssertCalled fails t unless method & path got exactly times requests
+func (s *Server) AssertCalled(t testing.TB, method string, path string, times int) {
+
+	t.Helper()
+
+	if got := len(s.RequestsTo(method, path)); got != times {
+		t.Errorf("%s %s called %d times, expected %d", method, path, got, times)
+	}
+}
+
+// AssertHeader fails t unless the last request to method & path had the header value
+func (s *Server) AssertHeader(t testing.TB, method string, path string, name string, value string) {
+
+	t.Helper()
+
+	reqs := s.RequestsTo(method, path)
+	if len(reqs) == 0 {
+		t.Errorf("%s %s not called", method, path)
+		return
+	}
+
+	if got := reqs[len(reqs)-1].Header.Get(name); got != value {
+		t.Errorf("%s %s header %s = %q, expected %q", method, path, name, got, value)
+	}
+}
+
+// AssertBody fails t unless the last request to method & path had the body
+func (s *Server) AssertBody(t testing.TB, method string, path string, body string) {
+
+	t.Helper()
+
+	reqs := s.RequestsTo(method, path)
+	if len(reqs) == 0 {
+		t.Errorf("%s %s not called", method, path)
+		return
+	}
+
+	if got := string(reqs[len(reqs)-1].Body); got != body {
+		t.Errorf("%s %s body = %q, expected %q", method, path, got, body)
+	}
+}
+
+// AssertRequest fails t unless a request to method & path satisfies check
+func (s *Server) AssertRequest(t testing.TB, method string, path string, check func(Request) bool) {
+
+	t.Helper()
+
+	for _, r := range s.RequestsTo(method, path) {
+		if check(r) {
+			return
+		}
+	}
+
+	t.Errorf("no request to %s %s as expected", method, path)
+}
+
+// AssertNoUnmatched fails t when a request matched no route
+func (s *Server) AssertNoUnmatched(t testing.TB) {
+
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.unmatched {
+		t.Errorf("unexpected request %s %s", r.Method, r.Path)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, req *http.Request) {
+
+	body, _ := io.ReadAll(req.Body)
+
+	rec := Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+		Body:   body,
+		Time:   time.Now(),
+	}
+
+	// Let a custom handler read the body again
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+
+	s.requests = append(s.requests, rec)
+
+	var (
+		route *Route
+		st    *step
+	)
+
+	for i := len(s.routes) - 1; i >= 0; i-- {
+		if s.routes[i].matches(req.Method, req.URL.Path) {
+			route = s.routes[i]
+			break
+		}
+	}
+
+	if route == nil {
+		s.unmatched = append(s.unmatched, rec)
+	} else {
+		st = route.next()
+	}
+
+	s.mu.Unlock()
+
+	if route == nil {
+		http.Error(w, fmt.Sprintf("no stub for %s %s", req.Method, req.URL.Path), http.StatusNotFound)
+		return
+	}
+
+	st.serve(s.t, w, req)
+}
+
+func (r *Route) matches(method string, path string) bool {
+
+	if r.method != "" && r.method != "*" && r.method != strings.ToUpper(method) {
+		return false
+	}
+
+	if strings.HasSuffix(r.path, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(r.path, "*"))
+	}
+
+	return r.path == path
+}
+
+// Step of the current call, must be called with s.mu held
+func (r *Route) next() *step {
+
+	r.calls++
+
+	if len(r.steps) == 0 {
+		return &step{}
+	}
+
+	if r.calls > len(r.steps) {
+		return r.steps[len(r.steps)-1]
+	}
+
+	return r.steps[r.calls-1]
+}
+
+// Step being configured
+func (r *Route) last() *step {
+
+	if len(r.steps) == 0 {
+		r.steps = append(r.steps, &step{})
+	}
+
+	return r.steps[len(r.steps)-1]
+}
+
+func (r *Route) edit(fn func(st *step)) *Route {
+
+	r.s.mu.Lock()
+	fn(r.last())
+	r.s.mu.Unlock()
+
+	return r
+}
+
+// Then starts the response of the following call
+func (r *Route) Then() *Route {
+
+	r.s.mu.Lock()
+	r.last()
+	r.steps = append(r.steps, &step{})
+	r.s.mu.Unlock()
+
+	return r
+}
+
+// Calls requests answered by the route so far
+func (r *Route) Calls() int {
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.calls
+}
+
+// Status code, default 200
+func (r *Route) Status(code int) *Route {
+	return r.edit(func(st *step) { st.status = code })
+}
+
+func (r *Route) Header(name string, value string) *Route {
+	return r.edit(func(st *step) {
+		if st.header == nil {
+			st.header = http.Header{}
+		}
+		st.header.Add(name, value)
+	})
+}
+
+func (r *Route) Body(body []byte) *Route {
+	return r.edit(func(st *step) { st.body = body })
+}
+
+func (r *Route) String(body string) *Route {
+	return r.Body([]byte(body))
+}
+
+// JSON status & json body of v ( []byte or string is sent as is )
+func (r *Route) JSON(code int, v interface{}) *Route {
+
+	body, err := encode(v, json.Marshal)
+	if err != nil {
+		r.s.t.Helper()
+		r.s.t.Fatalf("mylibtest: json body : %s", err)
+	}
+
+	return r.Status(code).Header("Content-Type", "application/json").Body(body)
+}
+
+// XML status & xml body of v ( []byte or string is sent as is )
+func (r *Route) XML(code int, v interface{}) *Route {
+
+	body, err := encode(v, xml.Marshal)
+	if err != nil {
+		r.s.t.Helper()
+		r.s.t.Fatalf("mylibtest: xml body : %s", err)
+	}
+
+	return r.Status(code).Header("Content-Type", "application/xml; charset=utf-8").Body(append([]byte(xml.Header), body...))
+}
+
+// SOAP envelope of version ( mylib.SOAP11 or mylib.SOAP12 ) around v ( []byte or string is sent as is )
+func (r *Route) SOAP(version string, v interface{}) *Route {
+
+	body, err := encode(v, xml.Marshal)
+	if err != nil {
+		r.s.t.Helper()
+		r.s.t.Fatalf("mylibtest: soap body : %s", err)
+	}
+
+	return r.soap(http.StatusOK, version, string(body))
+}
+
+// SOAPFault 500 with a fault, code is e.g. "soap:Server" (1.1) or "soap:Receiver" (1.2),
+// detail is the raw content of the detail element ( may be empty )
+func (r *Route) SOAPFault(version string, code string, reason string, detail string) *Route {
+
+	var b strings.Builder
+
+	b.WriteString("<soap:Fault>")
+
+	if version == mylib.SOAP12 {
+		b.WriteString("<soap:Code><soap:Value>" + escape(code) + "</soap:Value></soap:Code>")
+		b.WriteString(`<soap:Reason><soap:Text xml:lang="en">` + escape(reason) + "</soap:Text></soap:Reason>")
+		if detail != "" {
+			b.WriteString("<soap:Detail>" + detail + "</soap:Detail>")
+		}
+	} else {
+		b.WriteString("<faultcode>" + escape(code) + "</faultcode><faultstring>" + escape(reason) + "</faultstring>")
+		if detail != "" {
+			b.WriteString("<detail>" + detail + "</detail>")
+		}
+	}
+
+	b.WriteString("</soap:Fault>")
+
+	return r.soap(http.StatusInternalServerError, version, b.String())
+}
+
+func (r *Route) soap(code int, version string, content string) *Route {
+
+	ns, contentType := soap11Namespace, "text/xml; charset=utf-8"
+	if version == mylib.SOAP12 {
+		ns, contentType = soap12Namespace, "application/soap+xml; charset=utf-8"
+	}
+
+	envelope := xml.Header + `<soap:Envelope xmlns:soap="` + ns + `"><soap:Body>` + content + `</soap:Body></soap:Envelope>`
+
+	return r.Status(code).Header("Content-Type", contentType).String(envelope)
+}
+
+// Delay before the response headers are sent
+func (r *Route) Delay(d time.Duration) *Route {
+	return r.edit(func(st *step) { st.delay = d })
+}
+
+// SlowBody sends the body chunk bytes at a time, every apart
+func (r *Route) SlowBody(chunk int, every time.Duration) *Route {
+	return r.edit(func(st *step) {
+		if chunk <= 0 {
+			chunk = 1
+		}
+		st.chunk = chunk
+		st.every = every
+	})
+}
+
+// ResetConnection drops the connection ( TCP reset ) instead of answering, after Delay
+func (r *Route) ResetConnection() *Route {
+	return r.edit(func(st *step) { st.reset = true })
+}
+
+// HandlerFunc answers with fn, after Delay
+func (r *Route) HandlerFunc(fn http.HandlerFunc) *Route {
+	return r.edit(func(st *step) { st.handler = fn })
+}
+
+func (st *step) serve(t testing.TB, w http.ResponseWriter, req *http.Request) {
+
+	if st.delay > 0 {
+		select {
+		case <-time.After(st.delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	if st.reset {
+		if err := resetConnection(w); err != nil {
+			t.Errorf("mylibtest: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if st.handler != nil {
+		st.handler(w, req)
+		return
+	}
+
+	for k, vs := range st.header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+
+	status := st.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if st.chunk == 0 {
+		w.WriteHeader(status)
+		w.Write(st.body)
+		return
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprint(len(st.body)))
+	w.WriteHeader(status)
+
+	flusher, _ := w.(http.Flusher)
+
+	for body := st.body; len(body) != 0; {
+
+		n := st.chunk
+		if n > len(body) {
+			n = len(body)
+		}
+
+		if _, err := w.Write(body[:n]); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		body = body[n:]
+		if len(body) == 0 {
+			break
+		}
+
+		select {
+		case <-time.After(st.every):
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// Close the underlying connection with SO_LINGER 0, so the client gets a reset
+func resetConnection(w http.ResponseWriter) error {
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return fmt.Errorf("the connection cannot be hijacked")
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+
+	raw := conn
+	if nc, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		raw = nc.NetConn()
+	}
+
+	if tcp, ok := raw.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+
+	return conn.Close()
+}
+
+func encode(v interface{}, marshal func(interface{}) ([]byte, error)) ([]byte, error) {
+
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	}
+
+	return marshal(v)
+}
+
+func escape(s string) string {
+
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package mylibtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/wiliehidayat87/mylib/v2"
+)
+
+// Records what the assertions report instead of failing the test
+type recorder struct {
+	testing.TB
+	errors []string
+	fatal  bool
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.Errorf(format, args...)
+	r.fatal = true
+}
+
+func newClient(t *testing.T) *mylib.Client {
+
+	l := mylib.InitLog(mylib.Utils{LogPath: t.TempDir(), LogLevelInit: 2})
+	l.SetUpLog(mylib.Utils{LogThread: "test", LogName: "test"})
+	t.Cleanup(l.Close)
+
+	c := l.NewClient(mylib.PHttp{Timeout: 5})
+	t.Cleanup(c.Close)
+
+	return c
+}
+
+func TestStubs(t *testing.T) {
+
+	s := NewServer(t)
+	c := newClient(t)
+
+	s.Handle("GET", "/users/*").JSON(http.StatusOK, map[string]string{"name": "ann"}).
+		Then().Status(http.StatusServiceUnavailable).String("busy")
+
+	var out struct{ Name string }
+	if _, err := c.JSON(context.Background(), "GET", s.URL+"/users/1", map[string]string{"X-Trace": "t1"}, nil, &out, nil); err != nil || out.Name != "ann" {
+		t.Fatalf("first call : %+v, %v", out, err)
+	}
+
+	body, _, code, _ := c.Get(s.URL+"/users/2", nil)
+	if code != http.StatusServiceUnavailable || string(body) != "busy" {
+		t.Fatalf("second call : %d %q", code, body)
+	}
+
+	// The last step repeats
+	if _, _, code, _ := c.Get(s.URL+"/users/3", nil); code != http.StatusServiceUnavailable {
+		t.Fatalf("third call : %d", code)
+	}
+
+	s.AssertCalled(t, "GET", "/users/*", 3)
+	s.AssertHeader(t, "GET", "/users/1", "X-Trace", "t1")
+	s.AssertNoUnmatched(t)
+}
+
+func TestSOAPFault(t *testing.T) {
+
+	s := NewServer(t)
+	c := newClient(t)
+
+	s.Handle("POST", "/soap").SOAPFault(mylib.SOAP12, "soap:Receiver", "out of stock", "<sku>42</sku>")
+
+	_, err := c.NewSOAP(s.URL+"/soap", mylib.SOAPOptions{Version: mylib.SOAP12}).Call(context.Background(), "Order", nil, "<Order/>", nil)
+
+	var fault *mylib.SOAPFault
+	if !errors.As(err, &fault) || fault.Code != "soap:Receiver" || fault.String != "out of stock" || string(fault.Detail) != "<sku>42</sku>" {
+		t.Fatalf("expected the stubbed fault, got %#v", err)
+	}
+
+	s.AssertRequest(t, "POST", "/soap", func(r Request) bool {
+		return r.Header.Get("Content-Type") == `application/soap+xml; charset=utf-8; action="Order"`
+	})
+}
+
+func TestResetConnection(t *testing.T) {
+
+	s := NewServer(t)
+	c := newClient(t)
+
+	s.Handle("GET", "/reset").ResetConnection()
+
+	if _, _, _, err := c.Get(s.URL+"/reset", nil); err == nil {
+		t.Fatal("expected a transport error")
+	}
+}
+
+func TestAssertionsReport(t *testing.T) {
+
+	rec := &recorder{TB: t}
+
+	s := NewServer(t)
+	c := newClient(t)
+
+	s.Handle("POST", "/items").Status(http.StatusCreated)
+
+	c.Post(s.URL+"/items", map[string]string{"Content-Type": "text/plain"}, []byte("a"))
+	c.Get(s.URL+"/missing", nil)
+
+	s.AssertCalled(rec, "POST", "/items", 2)
+	s.AssertHeader(rec, "POST", "/items", "Content-Type", "application/json")
+	s.AssertBody(rec, "POST", "/items", "b")
+	s.AssertBody(rec, "GET", "/never", "")
+	s.AssertNoUnmatched(rec)
+
+	if len(rec.errors) != 5 {
+		t.Fatalf("expected 5 failures, got %q", rec.errors)
+	}
+
+	s.AssertBody(t, "POST", "/items", "a")
+}
+
+func TestStubEncodingErrors(t *testing.T) {
+
+	rec := &recorder{TB: t}
+
+	s := NewServer(rec)
+	s.Handle("GET", "/bad").JSON(http.StatusOK, make(chan int))
+
+	if !rec.fatal || len(rec.errors) != 1 {
+		t.Fatalf("expected a fatal json error, got %q", rec.errors)
+	}
+}
@@ -0,0 +1,268 @@
+package mylib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access token of a TokenSource
+type Token struct {
+	AccessToken string
+	TokenType   string    // "Bearer" unless the endpoint says otherwise
+	Expiry      time.Time // zero when the endpoint gave no expires_in
+}
+
+// Authorization header value
+func (t *Token) header() string {
+	return t.TokenType + " " + t.AccessToken
+}
+
+func (t *Token) valid(delta time.Duration) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry))
+}
+
+// TokenSource fetches client credentials tokens and caches them until shortly before they expire
+type TokenSource struct {
+	c   *Client
+	cfg OAuth2Config
+
+	// Only one refresh at a time, held while fetching
+	sem chan struct{}
+
+	mu  sync.Mutex
+	tok *Token
+}
+
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   interface{} `json:"expires_in"` // a number, or a string for some providers
+}
+
+// NewTokenSource token source calling cfg.TokenURL through its own client built from transport
+// The secrets & tokens are masked in what the token requests log, whatever l.Redaction says
+func (l *Utils) NewTokenSource(cfg OAuth2Config, transport PHttp) *TokenSource {
+
+	// Share the log queue, not the redaction settings
+	tl := *l
+	tl.Redaction.QueryParams = append(append([]string(nil), l.Redaction.QueryParams...), "client_secret", "client_assertion")
+	tl.Redaction.JSONPaths = append(append([]string(nil), l.Redaction.JSONPaths...), "access_token", "refresh_token", "id_token")
+
+	return &TokenSource{
+		c:   tl.NewClient(transport),
+		cfg: cfg,
+		sem: make(chan struct{}, 1),
+	}
+}
+
+// Token cached token, fetched again when missing or about to expire
+func (ts *TokenSource) Token(ctx context.Context) (*Token, error) {
+
+	if tok := ts.cached(); tok != nil {
+		return tok, nil
+	}
+
+	select {
+	case ts.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, wrapRequestError(ctx, ctx.Err())
+	}
+	defer func() { <-ts.sem }()
+
+	// Refreshed by another caller while waiting
+	if tok := ts.cached(); tok != nil {
+		return tok, nil
+	}
+
+	tok, err := ts.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ts.mu.Lock()
+	ts.tok = tok
+	ts.mu.Unlock()
+
+	return tok, nil
+}
+
+// Invalidate drops the cached token, the next call fetches a new one
+func (ts *TokenSource) Invalidate() {
+	ts.invalidate(nil)
+}
+
+// Close releases the idle connections to the token endpoint
+func (ts *TokenSource) Close() {
+	ts.c.Close()
+}
+
+// Middleware sets the Authorization header of every request, on a 401 the token
+// is fetched again and the request sent once more when its body can be replayed
+func (ts *TokenSource) Middleware() Middleware {
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+
+			ctx := req.Context()
+
+			tok, err := ts.Token(ctx)
+			if err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+
+			r := req.Clone(ctx)
+			r.Header.Set("Authorization", tok.header())
+
+			resp, err := next.RoundTrip(r)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+
+			replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+			if !replayable {
+				return resp, nil
+			}
+
+			ts.invalidate(tok)
+
+			fresh, err := ts.Token(ctx)
+			if err != nil {
+				return resp, nil
+			}
+
+			retry := req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return resp, nil
+				}
+				retry.Body = body
+			}
+			retry.Header.Set("Authorization", fresh.header())
+
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+
+			ts.c.l.writeHTTP(ctx, "info", fmt.Sprintf("Unauthorized with a cached token, retrying with a new one, Hit: %s", ts.c.l.RedactURL(req.URL.String())))
+
+			return next.RoundTrip(retry)
+		})
+	}
+}
+
+func (ts *TokenSource) delta() time.Duration {
+	if ts.cfg.ExpiryDelta <= 0 {
+		return time.Minute
+	}
+	return ts.cfg.ExpiryDelta
+}
+
+func (ts *TokenSource) cached() *Token {
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.tok.valid(ts.delta()) {
+		return ts.tok
+	}
+
+	return nil
+}
+
+// Drop the cached token when it is still old ( or always when old is nil )
+func (ts *TokenSource) invalidate(old *Token) {
+
+	ts.mu.Lock()
+	if old == nil || ts.tok == old {
+		ts.tok = nil
+	}
+	ts.mu.Unlock()
+}
+
+func (ts *TokenSource) fetch(ctx context.Context) (*Token, error) {
+
+	cfg := ts.cfg
+
+	form := neturl.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(cfg.Scopes) != 0 {
+		form.Set("scope", strings.Join(cfg.Scopes, " "))
+	}
+	if cfg.Audience != "" {
+		form.Set("audience", cfg.Audience)
+	}
+	for k, v := range cfg.ExtraParams {
+		form.Set(k, v)
+	}
+
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+
+	if cfg.AuthInParams {
+		form.Set("client_id", cfg.ClientID)
+		form.Set("client_secret", cfg.ClientSecret)
+	} else {
+		// RFC 6749 2.3.1 : both are form encoded before basic authentication
+		headers["Basic-Auth"] = neturl.QueryEscape(cfg.ClientID) + ":" + neturl.QueryEscape(cfg.ClientSecret)
+	}
+
+	var (
+		out    tokenResponse
+		errOut OAuth2Error
+	)
+
+	res, err := ts.c.JSON(ctx, "POST", cfg.TokenURL, headers, []byte(form.Encode()), &out, &errOut)
+	if err != nil {
+
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && errOut.Code != "" {
+			errOut.StatusCode = statusErr.StatusCode
+			return nil, &errOut
+		}
+
+		return nil, err
+	}
+
+	if out.AccessToken == "" {
+		return nil, &OAuth2Error{StatusCode: res.StatusCode, Code: "invalid_response", Description: "no access_token in the token response"}
+	}
+
+	tok := &Token{AccessToken: out.AccessToken, TokenType: out.TokenType}
+
+	if tok.TokenType == "" || strings.EqualFold(tok.TokenType, "bearer") {
+		tok.TokenType = "Bearer"
+	}
+
+	expires := "unknown"
+	if secs := expiresIn(out.ExpiresIn); secs > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(secs) * time.Second)
+		expires = (time.Duration(secs) * time.Second).String()
+	}
+
+	ts.c.l.writeHTTP(ctx, "info", fmt.Sprintf("OAuth2 token fetched, Hit: %s, Expires In: %s", ts.c.l.RedactURL(cfg.TokenURL), expires))
+
+	return tok, nil
+}
+
+func expiresIn(v interface{}) int64 {
+
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case string:
+		var secs int64
+		fmt.Sscan(n, &secs)
+		return secs
+	}
+
+	return 0
+}
@@ -0,0 +1,176 @@
+package mylib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Snapshot of a rate limiter, for monitoring
+type RateLimiterState struct {
+	Key      string  // "host:<host>" or "prefix:<prefix>"
+	Rate     float64 // requests per second
+	Burst    int
+	Tokens   float64 // available now, negative when callers are queued
+	Waiting  int     // callers blocked for a token
+	Allowed  uint64
+	Rejected uint64 // fail fast rejections and callers giving up while waiting
+}
+
+type limiterGroup struct {
+	mu       sync.Mutex
+	limiters map[string]*limiter
+}
+
+type limiter struct {
+	mu       sync.Mutex
+	rate     float64
+	burst    int
+	tokens   float64
+	last     time.Time
+	waiting  int
+	allowed  uint64
+	rejected uint64
+}
+
+func newLimiterGroup() *limiterGroup {
+	return &limiterGroup{limiters: make(map[string]*limiter)}
+}
+
+// First rule matching url, nil when none
+func matchRateLimit(rules []RateLimit, rawURL string) *RateLimit {
+
+	host := hostOf(rawURL)
+
+	for i := range rules {
+
+		r := &rules[i]
+		if r.Rate <= 0 {
+			continue
+		}
+
+		if r.Prefix != "" {
+			if strings.HasPrefix(rawURL, r.Prefix) {
+				return r
+			}
+		} else if strings.EqualFold(r.Host, host) {
+			return r
+		}
+	}
+
+	return nil
+}
+
+func (r *RateLimit) key() string {
+	if r.Prefix != "" {
+		return "prefix:" + r.Prefix
+	}
+	return "host:" + strings.ToLower(r.Host)
+}
+
+func (g *limiterGroup) get(r *RateLimit) *limiter {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	burst := r.Burst
+	if burst <= 0 {
+		burst = 1
+	}
+
+	lim := g.limiters[r.key()]
+	if lim == nil {
+		lim = &limiter{tokens: float64(burst), last: time.Now()}
+		g.limiters[r.key()] = lim
+	}
+
+	// Rules come with every call, the latest settings win
+	lim.mu.Lock()
+	lim.rate = r.Rate
+	lim.burst = burst
+	lim.mu.Unlock()
+
+	return lim
+}
+
+func (g *limiterGroup) states() []RateLimiterState {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	out := make([]RateLimiterState, 0, len(g.limiters))
+	for key, lim := range g.limiters {
+
+		lim.mu.Lock()
+		lim.refill(time.Now())
+		out = append(out, RateLimiterState{
+			Key:      key,
+			Rate:     lim.rate,
+			Burst:    lim.burst,
+			Tokens:   lim.tokens,
+			Waiting:  lim.waiting,
+			Allowed:  lim.allowed,
+			Rejected: lim.rejected,
+		})
+		lim.mu.Unlock()
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+
+	return out
+}
+
+// Must be called with lim.mu held
+func (lim *limiter) refill(now time.Time) {
+
+	lim.tokens += now.Sub(lim.last).Seconds() * lim.rate
+	if lim.tokens > float64(lim.burst) {
+		lim.tokens = float64(lim.burst)
+	}
+	lim.last = now
+}
+
+// Take a token, waiting for it unless failFast, returns the time waited
+func (lim *limiter) wait(ctx context.Context, failFast bool) (time.Duration, error) {
+
+	lim.mu.Lock()
+
+	lim.refill(time.Now())
+
+	if lim.tokens >= 1 {
+		lim.tokens--
+		lim.allowed++
+		lim.mu.Unlock()
+		return 0, nil
+	}
+
+	delay := time.Duration((1 - lim.tokens) / lim.rate * float64(time.Second))
+
+	if failFast {
+		lim.rejected++
+		lim.mu.Unlock()
+		return 0, fmt.Errorf("%w, next token in %s", ErrRateLimited, delay)
+	}
+
+	// Reserve the token now so waiters queue up behind each other
+	lim.tokens--
+	lim.waiting++
+	lim.mu.Unlock()
+
+	err := sleepCtx(ctx, delay)
+
+	lim.mu.Lock()
+	lim.waiting--
+	if err != nil {
+		lim.tokens++
+		lim.rejected++
+	} else {
+		lim.allowed++
+	}
+	lim.mu.Unlock()
+
+	return delay, err
+}
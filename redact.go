@@ -0,0 +1,267 @@
+package mylib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Headers never worth logging in clear, whatever Redaction.Headers says
+var alwaysRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Basic-Auth"}
+
+// Compiled Redaction.Patterns, keyed by expression
+var redactPatterns sync.Map
+
+func (r Redaction) mask() string {
+	if r.Mask == "" {
+		return "***"
+	}
+	return r.Mask
+}
+
+func (r Redaction) isSecretHeader(name string) bool {
+
+	for _, h := range alwaysRedactedHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+
+	for _, h := range r.Headers {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r Redaction) isSecretParam(name string) bool {
+
+	for _, p := range r.QueryParams {
+		if strings.EqualFold(p, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactString masks every match of Redaction.Patterns
+func (l *Utils) RedactString(s string) string {
+
+	for _, p := range l.Redaction.Patterns {
+
+		re, ok := redactPatterns.Load(p)
+		if !ok {
+			compiled, err := regexp.Compile(p)
+			if err != nil {
+				continue
+			}
+			re, _ = redactPatterns.LoadOrStore(p, compiled)
+		}
+
+		s = re.(*regexp.Regexp).ReplaceAllString(s, l.Redaction.mask())
+	}
+
+	return s
+}
+
+// RedactURL masks the userinfo password and the Redaction.QueryParams of a url
+func (l *Utils) RedactURL(rawURL string) string {
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return l.RedactString(rawURL)
+	}
+
+	// Re-added after String, which would escape the mask
+	userinfo := ""
+	if _, ok := u.User.Password(); ok {
+		userinfo = url.User(u.User.Username()).String() + ":" + l.Redaction.mask() + "@"
+		u.User = nil
+	}
+
+	if u.RawQuery != "" && len(l.Redaction.QueryParams) != 0 {
+		u.RawQuery = l.redactQuery(u.RawQuery)
+	}
+
+	redacted := u.String()
+	if userinfo != "" {
+		redacted = strings.Replace(redacted, "//", "//"+userinfo, 1)
+	}
+
+	return l.RedactString(redacted)
+}
+
+// Mask the secret parameters of an encoded query, keeping the parameter order
+func (l *Utils) redactQuery(rawQuery string) string {
+
+	pairs := strings.Split(rawQuery, "&")
+
+	for i, pair := range pairs {
+
+		key, _, _ := strings.Cut(pair, "=")
+		if name, err := url.QueryUnescape(key); err == nil && l.Redaction.isSecretParam(name) {
+			pairs[i] = key + "=" + l.Redaction.mask()
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// RedactBody masks Redaction.JSONPaths of a json body or Redaction.QueryParams of a form body,
+// then applies Redaction.Patterns
+func (l *Utils) RedactBody(body []byte) string {
+
+	trimmed := bytes.TrimSpace(body)
+
+	if len(l.Redaction.JSONPaths) != 0 && len(trimmed) != 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+
+		if redacted, ok := l.redactJSON(trimmed); ok {
+			return l.RedactString(redacted)
+		}
+	}
+
+	if len(l.Redaction.QueryParams) != 0 && bytes.IndexByte(trimmed, '=') > 0 && !bytes.ContainsAny(trimmed, " \n<{") {
+		return l.RedactString(l.redactQuery(string(trimmed)))
+	}
+
+	return l.RedactString(string(body))
+}
+
+func (l *Utils) redactJSON(body []byte) (string, bool) {
+
+	var doc interface{}
+
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&doc); err != nil {
+		return "", false
+	}
+
+	for _, p := range l.Redaction.JSONPaths {
+
+		if strings.HasPrefix(p, "..") {
+			doc = redactJSONDeep(doc, strings.Split(strings.TrimPrefix(p, ".."), "."), l.Redaction.mask())
+		} else {
+			doc = redactJSONPath(doc, strings.Split(p, "."), l.Redaction.mask())
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return "", false
+	}
+
+	return string(out), true
+}
+
+// Mask the value at path below v, "*" matching any key or index
+func redactJSONPath(v interface{}, path []string, mask string) interface{} {
+
+	if len(path) == 0 {
+		return mask
+	}
+
+	seg := path[0]
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			if seg == "*" || seg == k {
+				node[k] = redactJSONPath(child, path[1:], mask)
+			}
+		}
+	case []interface{}:
+		idx, err := strconv.Atoi(seg)
+		for i, child := range node {
+			if seg == "*" || (err == nil && idx == i) {
+				node[i] = redactJSONPath(child, path[1:], mask)
+			}
+		}
+	}
+
+	return v
+}
+
+// Mask the value at path wherever it starts below v
+func redactJSONDeep(v interface{}, path []string, mask string) interface{} {
+
+	v = redactJSONPath(v, path, mask)
+
+	switch node := v.(type) {
+	case map[string]interface{}:
+		for k, child := range node {
+			node[k] = redactJSONDeep(child, path, mask)
+		}
+	case []interface{}:
+		for i, child := range node {
+			node[i] = redactJSONDeep(child, path, mask)
+		}
+	}
+
+	return v
+}
+
+// RedactHeaders returns a copy of h with the secret headers masked
+func (l *Utils) RedactHeaders(h http.Header) http.Header {
+
+	out := h.Clone()
+
+	for k, vs := range out {
+
+		if l.Redaction.isSecretHeader(k) {
+			for i := range vs {
+				vs[i] = l.Redaction.mask()
+			}
+		} else if strings.EqualFold(k, "Cookie") || strings.EqualFold(k, "Set-Cookie") {
+			for i := range vs {
+				vs[i] = l.RedactString(vs[i])
+			}
+		}
+	}
+
+	return out
+}
+
+// Error text with the url of a *url.Error redacted
+func (l *Utils) redactErr(err error) string {
+
+	if err == nil {
+		return "<nil>"
+	}
+
+	msg := err.Error()
+
+	var uerr *url.Error
+	if errors.As(err, &uerr) && uerr.URL != "" {
+		msg = strings.ReplaceAll(msg, uerr.URL, l.RedactURL(uerr.URL))
+	}
+
+	return l.RedactString(msg)
+}
+
+// Write from the HTTP helpers, the whole message goes through Redaction.Patterns
+func (l *Utils) writeHTTP(ctx context.Context, logLevel string, logMsg string) {
+	l.WriteCtx(ctx, l.LogName, logLevel, l.RedactString(logMsg))
+}
+
+// writeHTTP with fields, string values are redacted too
+func (l *Utils) writeHTTPFields(ctx context.Context, logLevel string, logMsg string, fields map[string]interface{}) {
+
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			fields[k] = l.RedactString(s)
+		}
+	}
+
+	l.WriteCtxWithFields(ctx, l.LogName, logLevel, l.RedactString(logMsg), fields)
+}
@@ -0,0 +1,52 @@
+package mylib
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"time"
+)
+
+// Response of the HTTP helpers, the body is already read and the connection released
+type Response struct {
+	Method     string
+	URL        string // final url, after redirects
+	Status     string // e.g. "200 OK"
+	StatusCode int
+	Proto      string
+	Header     http.Header
+	Cookies    []*http.Cookie
+	Body       []byte
+	Elapsed    time.Duration // of the last attempt
+	Attempts   int           // 1 unless retried, see PHttp.Retry
+	Timings    Timings       // of the last attempt
+}
+
+// 2xx status
+func (r *Response) IsSuccess() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300
+}
+
+func (r *Response) String() string {
+	return string(r.Body)
+}
+
+// Decode a json body into v
+func (r *Response) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// Decode an xml body into v
+func (r *Response) XML(v interface{}) error {
+	return xml.Unmarshal(r.Body, v)
+}
+
+// A *StatusError for a non 2xx status, nil otherwise
+func (r *Response) ErrorForStatus() error {
+
+	if r.IsSuccess() {
+		return nil
+	}
+
+	return &StatusError{Method: r.Method, URL: r.URL, Status: r.Status, StatusCode: r.StatusCode, Body: r.Body}
+}
@@ -0,0 +1,142 @@
+package mylib
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header marking a non idempotent request as safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var defaultRetryOnStatus = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// Number of attempts allowed for a request
+func (r RetryPolicy) attempts(method string, headers map[string]string) int {
+
+	if r.MaxAttempts <= 1 {
+		return 1
+	}
+
+	if !r.RetryNonIdempotent && !isIdempotent(method) && !hasHeader(headers, IdempotencyKeyHeader) {
+		return 1
+	}
+
+	return r.MaxAttempts
+}
+
+func isIdempotent(method string) bool {
+
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+
+	return false
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+
+	for k, v := range headers {
+		if strings.EqualFold(k, name) && v != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether an attempt ended with a transport error or a retryable status
+func (r RetryPolicy) retryable(ctx context.Context, code int, err error) bool {
+
+	// The caller gave up, nothing to retry for
+	if ctx.Err() != nil {
+		return false
+	}
+
+	if err != nil {
+		return true
+	}
+
+	statuses := r.RetryOnStatus
+	if len(statuses) == 0 {
+		statuses = defaultRetryOnStatus
+	}
+
+	return ContainsInt(statuses, code)
+}
+
+// Delay before the attempt following attempt n ( 1 based )
+func (r RetryPolicy) backoff(n int, header http.Header) time.Duration {
+
+	base := r.BackoffBase
+	if base <= 0 {
+		base = 100 * time.Millisecond
+	}
+
+	limit := r.BackoffCap
+	if limit <= 0 {
+		limit = 10 * time.Second
+	}
+
+	if r.RespectRetryAfter {
+		if d, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+			if d > limit {
+				d = limit
+			}
+			return d
+		}
+	}
+
+	delay := limit
+	if n-1 < 32 {
+		if d := base << uint(n-1); d > 0 && d < limit {
+			delay = d
+		}
+	}
+
+	if r.Jitter {
+		delay = time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+
+	return delay
+}
+
+// Retry-After is either delay-seconds or an HTTP date
+func parseRetryAfter(v string) (time.Duration, bool) {
+
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// Sleep for d unless ctx is done first
+func sleepCtx(ctx context.Context, d time.Duration) error {
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
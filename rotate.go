@@ -0,0 +1,160 @@
+package mylib
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Daily files, size rotated files and their compressed variants :
+// 20060102.log, 20060102.1.log, 20060102.1.log.gz
+var logFilePattern = regexp.MustCompile(`^\d{8}(\.\d+)?\.log(\.gz)?$`)
+
+// Open (or create) a log file for appending
+func openLogFile(fullPathLog string) *os.File {
+
+	f, err := os.OpenFile(fullPathLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0777)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	f.Chmod(fs.ModePerm)
+	os.Chmod(fullPathLog, 0777)
+
+	return f
+}
+
+// Move 20060102.log aside as 20060102.<n>.log, compressed later by cleanupLogs
+func rotateFile(fullPathLog string) error {
+
+	dir := filepath.Dir(fullPathLog)
+	day := strings.TrimSuffix(filepath.Base(fullPathLog), ".log")
+
+	var rotated string
+	for n := 1; ; n++ {
+
+		rotated = filepath.Join(dir, fmt.Sprintf("%s.%d.log", day, n))
+
+		if !fileExists(rotated) && !fileExists(rotated+".gz") {
+			break
+		}
+	}
+
+	return os.Rename(fullPathLog, rotated)
+}
+
+// Compress the inactive log files of a directory and apply LogMaxAge / LogMaxBackups
+// Rotated files and the daily files of the days before activeDay are never written again,
+// the daily files from activeDay on are left alone
+func (l *Utils) cleanupLogs(dir string, activeDay string) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+
+	var files []logFile
+
+	for _, e := range entries {
+
+		if e.IsDir() || !logFilePattern.MatchString(e.Name()) {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		if name := strings.TrimSuffix(e.Name(), ".log"); len(name) == 8 && name >= activeDay {
+			continue
+		}
+
+		if l.LogCompress && !strings.HasSuffix(path, ".gz") {
+			if err := compressLogFile(path); err != nil {
+				log.Println(err)
+				continue
+			}
+			path += ".gz"
+		}
+
+		st, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, logFile{path: path, modTime: st.ModTime()})
+	}
+
+	// Newest first
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	cutoff := time.Now().AddDate(0, 0, -l.LogMaxAge)
+
+	for i, file := range files {
+
+		if (l.LogMaxBackups > 0 && i >= l.LogMaxBackups) || (l.LogMaxAge > 0 && file.modTime.Before(cutoff)) {
+			os.Remove(file.path)
+		}
+	}
+}
+
+// Gzip a file into <path>.gz and remove the original, readable by ReadGzFile
+func compressLogFile(path string) error {
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0777)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = filepath.Base(path)
+	zw.ModTime = st.ModTime()
+
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Keep the original modification time so retention stays by age
+	os.Chtimes(tmp, st.ModTime(), st.ModTime())
+
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
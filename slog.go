@@ -0,0 +1,136 @@
+package mylib
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SlogHandler is a slog.Handler writing into the same daily log files as Write
+// Levels are mapped onto the Write levels :
+// 1. slog.LevelError and above -> 'error' ( routed to the "error" log )
+// 2. slog.LevelInfo & slog.LevelWarn -> 'info'
+// 3. anything below slog.LevelInfo -> 'debug'
+type SlogHandler struct {
+	l       *Utils
+	logName string
+	attrs   []slogGroupAttr
+	prefix  string
+}
+
+// Attribute of WithAttrs with the group prefix in effect when it was added
+type slogGroupAttr struct {
+	prefix string
+	attr   slog.Attr
+}
+
+// Instance of a slog handler
+// param :
+// 1. @logName ( log directory under LogPath, as passed to SetUpLog ) -> string
+// returns :
+// 1. @SlogHandler -> slog.Handler
+//
+// usage : slog.New(l.NewSlogHandler(l.LogName))
+func (l *Utils) NewSlogHandler(logName string) *SlogHandler {
+	return &SlogHandler{l: l, logName: logName}
+}
+
+func slogLevelName(level slog.Level) string {
+
+	if level >= slog.LevelError {
+		return "error"
+	} else if level >= slog.LevelInfo {
+		return "info"
+	}
+
+	return "debug"
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+
+	lv := parseLogLevel(slogLevelName(level))
+
+	// Errors are always written to the "error" log
+	return lv == 3 || h.l.isLevelAllowed(lv)
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+
+	fields := make(map[string]interface{}, len(h.attrs)+r.NumAttrs())
+
+	for _, ga := range h.attrs {
+		addSlogAttr(fields, ga.prefix, ga.attr)
+	}
+
+	r.Attrs(func(a slog.Attr) bool {
+		addSlogAttr(fields, h.prefix, a)
+		return true
+	})
+
+	// A zero record time is left out by slog handlers, the line still needs one
+	at := r.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	// Request id and fields carried by ctx, see WithRequestID & WithLogFields
+	h.l.writeCtx(ctx, at, h.logName, slogLevelName(r.Level), r.Message, fields)
+
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := *h
+	h2.attrs = make([]slogGroupAttr, 0, len(h.attrs)+len(attrs))
+	h2.attrs = append(h2.attrs, h.attrs...)
+
+	// Keep the current prefix, later groups must not apply to these
+	for _, a := range attrs {
+		h2.attrs = append(h2.attrs, slogGroupAttr{prefix: h.prefix, attr: a})
+	}
+
+	return &h2
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+
+	return &h2
+}
+
+// Flatten an attribute into fields, nested groups become dotted keys
+func addSlogAttr(fields map[string]interface{}, prefix string, a slog.Attr) {
+
+	a.Value = a.Value.Resolve()
+
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	if a.Value.Kind() == slog.KindGroup {
+
+		groupPrefix := prefix
+		if a.Key != "" {
+			groupPrefix = prefix + a.Key + "."
+		}
+
+		for _, ga := range a.Value.Group() {
+			addSlogAttr(fields, groupPrefix, ga)
+		}
+
+		return
+	}
+
+	fields[prefix+a.Key] = a.Value.Any()
+}
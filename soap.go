@@ -0,0 +1,322 @@
+package mylib
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SOAP versions
+const (
+	SOAP11 = "1.1"
+	SOAP12 = "1.2"
+)
+
+// WS-Security UsernameToken password types
+const (
+	WSSPasswordText   = "PasswordText"
+	WSSPasswordDigest = "PasswordDigest"
+)
+
+const (
+	soap11Namespace = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+
+	wsseNamespace = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	wsuNamespace  = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	wssTokenTypes = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#"
+	wssBase64     = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
+)
+
+// SOAPClient posts envelopes to one endpoint through a Client
+type SOAPClient struct {
+	c   *Client
+	url string
+	opt SOAPOptions
+}
+
+// NewSOAP SOAP client for an endpoint, sharing the transport, retry, breaker & rate limit of c
+func (c *Client) NewSOAP(url string, opt SOAPOptions) *SOAPClient {
+
+	if opt.Version != SOAP12 {
+		opt.Version = SOAP11
+	}
+
+	return &SOAPClient{c: c, url: url, opt: opt}
+}
+
+// Call method
+// param :
+// 1. @action ( SOAPAction header for 1.1, action parameter of the content type for 1.2, may be empty ) -> string
+// 2. @headers ( extra HTTP headers ) -> map[string]string
+// 3. @in ( body content, marshalled with encoding/xml, []byte is sent as is ) -> interface{}
+// 4. @out ( filled from the first element of the response body, nil to ignore it ) -> pointer
+// returns :
+// 1. @Response, @error ( a *SOAPFault for a fault, a *StatusError for another non 2xx status )
+func (s *SOAPClient) Call(ctx context.Context, action string, headers map[string]string, in interface{}, out interface{}) (*Response, error) {
+
+	l := s.c.l
+
+	envelope, err := s.envelope(in)
+	if err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Couldn't build soap envelope : %s, Hit: %s", err, l.RedactURL(s.url)))
+		return nil, err
+	}
+
+	h := make(map[string]string, len(headers)+2)
+	for k, v := range headers {
+		h[k] = v
+	}
+
+	if s.opt.Version == SOAP12 {
+
+		contentType := "application/soap+xml; charset=utf-8"
+		if action != "" {
+			contentType += `; action="` + action + `"`
+		}
+		h["Content-Type"] = contentType
+		h["Accept"] = "application/soap+xml, text/xml"
+	} else {
+
+		h["Content-Type"] = "text/xml; charset=utf-8"
+		h["Accept"] = "text/xml"
+		h["SOAPAction"] = `"` + action + `"`
+	}
+
+	// The envelope is logged with the WS-Security password & nonce masked
+	res, err := s.c.sendBody(ctx, "POST", s.url, h, requestBody{data: envelope, log: l.logBody(redactWSSecurity(envelope, l.Redaction.mask()), h["Content-Type"])})
+	if err != nil {
+		return res, err
+	}
+
+	body, fault, perr := parseSOAPResponse(res.Body)
+	if perr != nil {
+
+		if !res.IsSuccess() {
+			return res, res.ErrorForStatus()
+		}
+
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Couldn't parse soap response : %s, Hit: %s", perr, l.RedactURL(s.url)))
+
+		return res, perr
+	}
+
+	if fault != nil {
+
+		fault.Version = s.opt.Version
+		fault.StatusCode = res.StatusCode
+
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Soap fault : %s, Hit: %s", fault.Error(), l.RedactURL(s.url)))
+
+		return res, fault
+	}
+
+	if !res.IsSuccess() {
+		return res, res.ErrorForStatus()
+	}
+
+	if out != nil && len(bytes.TrimSpace(body)) != 0 {
+
+		if err := xml.Unmarshal(body, out); err != nil {
+
+			l.writeHTTP(ctx, "error", fmt.Sprintf("Couldn't decode soap body : %s, Hit: %s", err, l.RedactURL(s.url)))
+
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// SOAPCall builds a one shot client from transport, prefer NewClient & NewSOAP for repeated calls
+func (l *Utils) SOAPCall(ctx context.Context, url string, action string, headers map[string]string, in interface{}, out interface{}, opt SOAPOptions, transport PHttp) (*Response, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.NewSOAP(url, opt).Call(ctx, action, headers, in, out)
+}
+
+func (s *SOAPClient) envelope(in interface{}) ([]byte, error) {
+
+	ns := soap11Namespace
+	if s.opt.Version == SOAP12 {
+		ns = soap12Namespace
+	}
+
+	var b bytes.Buffer
+
+	b.WriteString(xml.Header)
+	b.WriteString(`<soap:Envelope xmlns:soap="` + ns + `">`)
+
+	if s.opt.Security != nil || len(s.opt.Headers) != 0 {
+
+		b.WriteString("<soap:Header>")
+
+		if s.opt.Security != nil {
+			if err := s.opt.Security.write(&b, s.opt.Version); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, hdr := range s.opt.Headers {
+			if err := writeSOAPContent(&b, hdr); err != nil {
+				return nil, err
+			}
+		}
+
+		b.WriteString("</soap:Header>")
+	}
+
+	b.WriteString("<soap:Body>")
+	if err := writeSOAPContent(&b, in); err != nil {
+		return nil, err
+	}
+	b.WriteString("</soap:Body></soap:Envelope>")
+
+	return b.Bytes(), nil
+}
+
+func writeSOAPContent(b *bytes.Buffer, v interface{}) error {
+
+	switch c := v.(type) {
+	case nil:
+	case []byte:
+		b.Write(c)
+	case string:
+		b.WriteString(c)
+	default:
+		out, err := xml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(out)
+	}
+
+	return nil
+}
+
+// Write the wsse:Security header, a digest password is Base64( SHA-1( nonce + created + password ) )
+func (w *WSSecurity) write(b *bytes.Buffer, version string) error {
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	created := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+
+	passwordType := WSSPasswordText
+	password := w.Password
+
+	if w.PasswordType == WSSPasswordDigest {
+
+		passwordType = WSSPasswordDigest
+
+		h := sha1.New()
+		h.Write(nonce)
+		h.Write([]byte(created))
+		h.Write([]byte(w.Password))
+		password = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+
+	b.WriteString(`<wsse:Security xmlns:wsse="` + wsseNamespace + `" xmlns:wsu="` + wsuNamespace + `"`)
+	if w.MustUnderstand {
+		if version == SOAP12 {
+			b.WriteString(` soap:mustUnderstand="true"`)
+		} else {
+			b.WriteString(` soap:mustUnderstand="1"`)
+		}
+	}
+	b.WriteString(`><wsse:UsernameToken><wsse:Username>`)
+	xml.EscapeText(b, []byte(w.Username))
+	b.WriteString(`</wsse:Username><wsse:Password Type="` + wssTokenTypes + passwordType + `">`)
+	xml.EscapeText(b, []byte(password))
+	b.WriteString(`</wsse:Password><wsse:Nonce EncodingType="` + wssBase64 + `">`)
+	b.WriteString(base64.StdEncoding.EncodeToString(nonce))
+	b.WriteString(`</wsse:Nonce><wsu:Created>` + created + `</wsu:Created></wsse:UsernameToken></wsse:Security>`)
+
+	return nil
+}
+
+var wsseSecretXML = regexp.MustCompile(`(<wsse:(?:Password|Nonce)\b[^>]*>)[^<]*(</wsse:(?:Password|Nonce)>)`)
+
+// Envelope with the content of wsse:Password & wsse:Nonce replaced by mask
+func redactWSSecurity(envelope []byte, mask string) []byte {
+	return wsseSecretXML.ReplaceAll(envelope, []byte("${1}"+strings.ReplaceAll(mask, "$", "$$")+"${2}"))
+}
+
+type soapResponseEnvelope struct {
+	Body struct {
+		Fault   *soapFaultXML `xml:"Fault"`
+		Content []byte        `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+// Both 1.1 and 1.2 fault layouts, elements are matched by local name
+type soapFaultXML struct {
+	FaultCode   string   `xml:"faultcode"`
+	FaultString string   `xml:"faultstring"`
+	FaultActor  string   `xml:"faultactor"`
+	Detail11    innerXML `xml:"detail"`
+
+	Code struct {
+		Value   string `xml:"Value"`
+		Subcode struct {
+			Value string `xml:"Value"`
+		} `xml:"Subcode"`
+	} `xml:"Code"`
+	Reason   []string `xml:"Reason>Text"`
+	Node     string   `xml:"Node"`
+	Role     string   `xml:"Role"`
+	Detail12 innerXML `xml:"Detail"`
+}
+
+type innerXML struct {
+	Content []byte `xml:",innerxml"`
+}
+
+// Content of soap:Body, or its fault
+func parseSOAPResponse(data []byte) ([]byte, *SOAPFault, error) {
+
+	var env soapResponseEnvelope
+	if err := xml.Unmarshal(data, &env); err != nil {
+		return nil, nil, err
+	}
+
+	f := env.Body.Fault
+	if f == nil {
+		return env.Body.Content, nil, nil
+	}
+
+	fault := &SOAPFault{
+		Code:    strings.TrimSpace(f.FaultCode),
+		String:  strings.TrimSpace(f.FaultString),
+		Actor:   strings.TrimSpace(f.FaultActor),
+		Role:    strings.TrimSpace(f.Role),
+		Subcode: strings.TrimSpace(f.Code.Subcode.Value),
+		Detail:  bytes.TrimSpace(f.Detail11.Content),
+	}
+
+	if fault.Code == "" {
+		fault.Code = strings.TrimSpace(f.Code.Value)
+	}
+	if fault.String == "" && len(f.Reason) != 0 {
+		fault.String = strings.TrimSpace(f.Reason[0])
+	}
+	if fault.Actor == "" {
+		fault.Actor = strings.TrimSpace(f.Node)
+	}
+	if len(fault.Detail) == 0 {
+		fault.Detail = bytes.TrimSpace(f.Detail12.Content)
+	}
+
+	return nil, fault, nil
+}
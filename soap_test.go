@@ -0,0 +1,84 @@
+package mylib
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The WS-Security password & nonce must never reach the log files
+func TestSOAPCallRedactsWSSecurity(t *testing.T) {
+
+	const password = "S3cretPw!"
+
+	var envelopes []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		envelopes = append(envelopes, string(b))
+
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		io.WriteString(w, `<soap:Envelope xmlns:soap="`+soap11Namespace+`"><soap:Body><Pong/></soap:Body></soap:Envelope>`)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+
+	l := InitLog(Utils{LogPath: dir, LogLevelInit: 2})
+	l.SetUpLog(Utils{LogThread: "test", LogName: "soap"})
+
+	c := l.NewClient(PHttp{Timeout: 5})
+	defer c.Close()
+
+	for _, passwordType := range []string{WSSPasswordText, WSSPasswordDigest} {
+
+		s := c.NewSOAP(srv.URL, SOAPOptions{Security: &WSSecurity{Username: "user", Password: password, PasswordType: passwordType}})
+
+		if _, err := s.Call(context.Background(), "Ping", nil, "<Ping/>", nil); err != nil {
+			t.Fatalf("%s : %s", passwordType, err)
+		}
+	}
+
+	l.Close()
+
+	var logs strings.Builder
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(path)
+		logs.Write(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secrets := []string{password}
+	secretXML := regexp.MustCompile(`<wsse:(?:Password|Nonce)[^>]*>([^<]+)<`)
+	for _, env := range envelopes {
+		for _, m := range secretXML.FindAllStringSubmatch(env, -1) {
+			secrets = append(secrets, m[1])
+		}
+	}
+	if len(secrets) != 5 {
+		t.Fatalf("expected a password & nonce per envelope, got %q", secrets)
+	}
+
+	for _, secret := range secrets {
+		if strings.Contains(logs.String(), secret) {
+			t.Errorf("%q found in the logs :\n%s", secret, logs.String())
+		}
+	}
+
+	if !strings.Contains(logs.String(), `PasswordText">***</wsse:Password>`) {
+		t.Errorf("masked envelope not logged :\n%s", logs.String())
+	}
+}
@@ -0,0 +1,144 @@
+package mylib
+
+import (
+	"crypto/tls"
+	"math"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings of one attempt, phases that did not happen ( e.g. DNS & Connect on a reused connection ) are 0
+type Timings struct {
+	DNS        time.Duration // dns lookup
+	Connect    time.Duration // tcp connect
+	TLS        time.Duration // tls handshake
+	TTFB       time.Duration // from getting a connection to the first response byte ( request write & server time )
+	Transfer   time.Duration // from the first response byte to the end of the body
+	Total      time.Duration // whole attempt
+	Reused     bool          // the connection came from the idle pool
+	RemoteAddr string
+}
+
+// Log fields of the timings, durations in milliseconds
+func (t Timings) fields() map[string]interface{} {
+
+	fields := map[string]interface{}{
+		"dns_ms":      durationMS(t.DNS),
+		"connect_ms":  durationMS(t.Connect),
+		"tls_ms":      durationMS(t.TLS),
+		"ttfb_ms":     durationMS(t.TTFB),
+		"transfer_ms": durationMS(t.Transfer),
+		"total_ms":    durationMS(t.Total),
+		"reused":      t.Reused,
+	}
+
+	if t.RemoteAddr != "" {
+		fields["remote_addr"] = t.RemoteAddr
+	}
+
+	return fields
+}
+
+func durationMS(d time.Duration) float64 {
+	return math.Round(float64(d)/float64(time.Microsecond)) / 1000
+}
+
+// Collects Timings from httptrace callbacks, which may run on other goroutines
+type timingTrace struct {
+	mu sync.Mutex
+
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	gotConn      time.Time
+	firstByte    time.Time
+
+	t Timings
+}
+
+func newTimingTrace() *timingTrace {
+	return &timingTrace{start: time.Now()}
+}
+
+func (tt *timingTrace) clientTrace() *httptrace.ClientTrace {
+
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tt.mu.Lock()
+			tt.dnsStart = time.Now()
+			tt.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tt.mu.Lock()
+			if !tt.dnsStart.IsZero() {
+				tt.t.DNS = time.Since(tt.dnsStart)
+			}
+			tt.mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			tt.mu.Lock()
+			// Several dials may race ( ipv4 / ipv6 ), time from the first one
+			if tt.connectStart.IsZero() {
+				tt.connectStart = time.Now()
+			}
+			tt.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			tt.mu.Lock()
+			if err == nil && !tt.connectStart.IsZero() {
+				tt.t.Connect = time.Since(tt.connectStart)
+			}
+			tt.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			tt.mu.Lock()
+			tt.tlsStart = time.Now()
+			tt.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tt.mu.Lock()
+			if !tt.tlsStart.IsZero() {
+				tt.t.TLS = time.Since(tt.tlsStart)
+			}
+			tt.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			tt.mu.Lock()
+			tt.gotConn = time.Now()
+			tt.t.Reused = info.Reused
+			if info.Conn != nil {
+				tt.t.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+			tt.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			tt.mu.Lock()
+			tt.firstByte = time.Now()
+			tt.mu.Unlock()
+		},
+	}
+}
+
+// Timings once the attempt is over
+func (tt *timingTrace) done() Timings {
+
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	end := time.Now()
+
+	t := tt.t
+	t.Total = end.Sub(tt.start)
+
+	if !tt.firstByte.IsZero() {
+
+		if !tt.gotConn.IsZero() {
+			t.TTFB = tt.firstByte.Sub(tt.gotConn)
+		}
+		t.Transfer = end.Sub(tt.firstByte)
+	}
+
+	return t
+}
@@ -0,0 +1,129 @@
+package mylib
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// tls.Config of PHttp.TLS
+func newTLSConfig(t TLSConfig) (*tls.Config, error) {
+
+	cfg := &tls.Config{
+		InsecureSkipVerify: t.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         t.ServerName,
+	}
+
+	if t.MinVersion != 0 {
+		cfg.MinVersion = t.MinVersion
+	}
+
+	if len(t.RootCAFiles) != 0 || len(t.RootCAPEM) != 0 {
+
+		pool := x509.NewCertPool()
+		if t.SystemRoots {
+			sys, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, fmt.Errorf("%w: system roots : %w", ErrTLSConfig, err)
+			}
+			pool = sys
+		}
+
+		for _, file := range t.RootCAFiles {
+
+			pem, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrTLSConfig, err)
+			}
+
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%w: no certificate in %s", ErrTLSConfig, file)
+			}
+		}
+
+		if len(t.RootCAPEM) != 0 && !pool.AppendCertsFromPEM(t.RootCAPEM) {
+			return nil, fmt.Errorf("%w: no certificate in RootCAPEM", ErrTLSConfig)
+		}
+
+		cfg.RootCAs = pool
+	}
+
+	for i, c := range t.Certificates {
+
+		var (
+			cert tls.Certificate
+			err  error
+		)
+
+		if c.CertFile != "" {
+			cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		} else {
+			cert, err = tls.X509KeyPair(c.CertPEM, c.KeyPEM)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: client certificate %d : %w", ErrTLSConfig, i, err)
+		}
+
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+
+	if len(t.PinnedSPKI) != 0 {
+
+		pins := make(map[string]bool, len(t.PinnedSPKI))
+		for _, pin := range t.PinnedSPKI {
+			pins[pin] = true
+		}
+
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, pins, t.InsecureSkipVerify)
+		}
+	}
+
+	return cfg, nil
+}
+
+// One certificate of the verified chains ( of the presented ones when verification is off ) must match a pin
+func verifyPins(cs tls.ConnectionState, pins map[string]bool, insecure bool) error {
+
+	chains := cs.VerifiedChains
+	if insecure || len(chains) == 0 {
+		chains = [][]*x509.Certificate{cs.PeerCertificates}
+	}
+
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if pins[SPKIHash(cert)] {
+				return nil
+			}
+		}
+	}
+
+	return fmt.Errorf("%w for %s", ErrCertificatePin, cs.ServerName)
+}
+
+// SPKIHash base64 SHA-256 of the SubjectPublicKeyInfo of a certificate, as expected by PinnedSPKI
+func SPKIHash(cert *x509.Certificate) string {
+
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Round tripper of a client with an invalid tls config, every call fails with the config error
+type errRoundTripper struct {
+	err error
+}
+
+func (e errRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	return nil, e.err
+}
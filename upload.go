@@ -0,0 +1,292 @@
+package mylib
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// UploadFiles streams a multipart/form-data POST, files are read while sending
+// param :
+// 1. @fields ( plain form fields, sent before the files ) -> map[string]string
+// 2. @files ( see UploadFile ) -> []UploadFile
+// 3. @progress ( bytes of the body sent so far, may be nil ) -> ProgressFunc
+// returns :
+// 1. @Response, @error
+//
+// The body is rebuilt for every attempt, so PHttp.Retry applies ( with RetryNonIdempotent or an Idempotency-Key header )
+func (c *Client) UploadFiles(ctx context.Context, url string, headers map[string]string, fields map[string]string, files []UploadFile, progress ProgressFunc) (*Response, error) {
+
+	l := c.l
+
+	boundary, err := newBoundary()
+	if err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Error Occured : %s", err))
+		return nil, err
+	}
+
+	mp := &multipartBody{boundary: boundary, fields: fields, files: files}
+
+	size, err := mp.size()
+	if err != nil {
+		l.writeHTTP(ctx, "error", fmt.Sprintf("Failed open file : %v, URL : %s", err, l.RedactURL(url)))
+		return nil, err
+	}
+
+	h := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		h[k] = v
+	}
+	h["Content-Type"] = "multipart/form-data; boundary=" + boundary
+
+	// Middlewares reading GetBody ( HMACSigner ) don't report progress
+	return c.sendBody(ctx, "POST", url, h, requestBody{
+		open:   func() (io.ReadCloser, error) { return mp.open(size, progress) },
+		replay: func() (io.ReadCloser, error) { return mp.open(size, nil) },
+		size:   size,
+		log:    mp.log(l),
+	})
+}
+
+// UploadFiles builds a one shot client from transport, prefer NewClient for repeated calls
+func (l *Utils) UploadFiles(ctx context.Context, url string, headers map[string]string, fields map[string]string, files []UploadFile, progress ProgressFunc, transport PHttp) (*Response, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.UploadFiles(ctx, url, headers, fields, files, progress)
+}
+
+type multipartBody struct {
+	boundary string
+	fields   map[string]string
+	files    []UploadFile
+}
+
+func newBoundary() (string, error) {
+
+	var b [30]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", b[:]), nil
+}
+
+func (f UploadFile) field() string {
+	if f.Field == "" {
+		return "file"
+	}
+	return f.Field
+}
+
+func (f UploadFile) name() string {
+	if f.Name == "" {
+		return filepath.Base(f.Path)
+	}
+	return f.Name
+}
+
+func (f UploadFile) contentType() string {
+	if f.ContentType == "" {
+		return "application/octet-stream"
+	}
+	return f.ContentType
+}
+
+func (f UploadFile) open() (io.ReadCloser, error) {
+	if f.Open != nil {
+		return f.Open()
+	}
+	return os.Open(f.Path)
+}
+
+// Size of a file part, -1 when unknown
+func (f UploadFile) length() (int64, error) {
+
+	if f.Open != nil {
+		if f.Size > 0 {
+			return f.Size, nil
+		}
+		return -1, nil
+	}
+
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func (f UploadFile) header() textproto.MIMEHeader {
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(f.field()), quoteEscaper.Replace(f.name())))
+	h.Set("Content-Type", f.contentType())
+
+	return h
+}
+
+// Write the whole body, file contents come from content
+func (mp *multipartBody) write(w io.Writer, content func(f UploadFile, part io.Writer) error) error {
+
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(mp.boundary); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(mp.fields))
+	for k := range mp.fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := mw.WriteField(k, mp.fields[k]); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range mp.files {
+
+		part, err := mw.CreatePart(f.header())
+		if err != nil {
+			return err
+		}
+
+		if err := content(f, part); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// Content length of the body, from a dry run without the file contents, -1 when a size is unknown
+func (mp *multipartBody) size() (int64, error) {
+
+	var (
+		files   int64
+		unknown bool
+	)
+
+	for _, f := range mp.files {
+
+		n, err := f.length()
+		if err != nil {
+			return 0, err
+		}
+
+		if n < 0 {
+			unknown = true
+		}
+		files += n
+	}
+
+	if unknown {
+		return -1, nil
+	}
+
+	cw := &countingWriter{}
+	if err := mp.write(cw, func(UploadFile, io.Writer) error { return nil }); err != nil {
+		return 0, err
+	}
+
+	return cw.n + files, nil
+}
+
+// Body streamed through a pipe, the files are opened one at a time while sending
+func (mp *multipartBody) open(size int64, progress ProgressFunc) (io.ReadCloser, error) {
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(mp.write(pw, func(f UploadFile, part io.Writer) error {
+
+			r, err := f.open()
+			if err != nil {
+				return err
+			}
+			defer r.Close()
+
+			_, err = io.Copy(part, r)
+
+			return err
+		}))
+	}()
+
+	if progress == nil {
+		return pr, nil
+	}
+
+	return &progressReader{r: pr, c: pr, total: size, progress: progress}, nil
+}
+
+// What is logged in place of the body : the redacted fields and the files
+func (mp *multipartBody) log(l *Utils) string {
+
+	form := neturl.Values{}
+	for k, v := range mp.fields {
+		form.Set(k, v)
+	}
+
+	parts := make([]string, 0, len(mp.files))
+	for _, f := range mp.files {
+
+		size := "unknown size"
+		if n, err := f.length(); err == nil && n >= 0 {
+			size = fmt.Sprintf("%d bytes", n)
+		}
+
+		parts = append(parts, fmt.Sprintf("%s=%s (%s, %s)", f.field(), f.name(), f.contentType(), size))
+	}
+
+	return fmt.Sprintf("multipart fields [%s] files [%s]", l.RedactBody([]byte(form.Encode())), strings.Join(parts, ", "))
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Reports the bytes read so far to progress
+type progressReader struct {
+	r        io.Reader
+	c        io.Closer
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.progress(atomic.AddInt64(&p.done, int64(n)), p.total)
+	}
+
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	if p.c == nil {
+		return nil
+	}
+	return p.c.Close()
+}
@@ -6,11 +6,14 @@ import (
 	"compress/gzip"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha256"
 	b64 "encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"hash"
+	"io"
 	"log"
 	"math/rand"
 	"os"
@@ -344,6 +347,34 @@ func GetMD5(s string) string {
 	return secretKey
 }
 
+// GetSHA256 hex SHA-256 of s
+func GetSHA256(s string) string {
+	return hexDigest(sha256.New, s)
+}
+
+// GetHMACSHA256 hex HMAC-SHA256 of s
+func GetHMACSHA256(key string, s string) string {
+	return hexHMAC(sha256.New, key, s)
+}
+
+// Hex digest of s with the hash of fn
+func hexDigest(fn func() hash.Hash, s string) string {
+
+	h := fn()
+	h.Write([]byte(s))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Hex HMAC of s with the hash of fn
+func hexHMAC(fn func() hash.Hash, key string, s string) string {
+
+	mac := hmac.New(fn, []byte(key))
+	mac.Write([]byte(s))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func ReadASingleValueInFile(filename string, keyword string) string {
 
 	var path []string
@@ -411,8 +442,7 @@ func ReadGzFile(filename string) ([]byte, error) {
 	}
 	defer fz.Close()
 
-	s := bufio.NewScanner(fz)
-	return s.Bytes(), nil
+	return io.ReadAll(fz)
 }
 
 func Copy(srcFolder string, destFolder string) bool {
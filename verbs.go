@@ -0,0 +1,175 @@
+package mylib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"strings"
+)
+
+// Do sends any method with the same tracing, logging, retry, breaker & rate limit as Get / Post
+// param :
+// 1. @method ( GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS ... ) -> string
+// 2. @url -> string
+// 3. @headers ( "Basic-Auth" : "user:password" sets basic authentication ) -> map[string]string
+// 4. @query ( added to the query string of url ) -> map[string]string
+// 5. @body ( read fully before sending so it can be logged and retried, nil = no body ) -> io.Reader
+// returns :
+// 1. @body, @status, @status code, @error
+func (c *Client) Do(method string, url string, headers map[string]string, query map[string]string, body io.Reader) ([]byte, string, int, error) {
+	return c.DoCtx(context.Background(), method, url, headers, query, body)
+}
+
+// DoCtx, Do canceled when ctx is done ( see ErrRequestCanceled & ErrRequestTimeout )
+func (c *Client) DoCtx(ctx context.Context, method string, url string, headers map[string]string, query map[string]string, body io.Reader) ([]byte, string, int, error) {
+	return responseTuple(c.Request(ctx, method, url, headers, query, body))
+}
+
+// Request, DoCtx returning the whole *Response ( headers, cookies, final url, timing ... )
+// The response is nil when no attempt got one, a non 2xx status is not an error ( see Response.ErrorForStatus )
+func (c *Client) Request(ctx context.Context, method string, url string, headers map[string]string, query map[string]string, body io.Reader) (*Response, error) {
+
+	fullURL, err := withQuery(url, query)
+	if err != nil {
+		c.l.writeHTTP(ctx, "error", fmt.Sprintf("Error Occured : %s", c.l.redactErr(err)))
+		return nil, err
+	}
+
+	var payload []byte
+	if body != nil {
+
+		payload, err = io.ReadAll(body)
+		if err != nil {
+			c.l.writeHTTP(ctx, "error", fmt.Sprintf("Couldn't read request body : %s, Hit: %s", c.l.redactErr(err), c.l.RedactURL(fullURL)))
+			return nil, err
+		}
+	}
+
+	return c.send(ctx, strings.ToUpper(method), fullURL, headers, payload)
+}
+
+func (c *Client) Put(url string, headers map[string]string, body []byte) ([]byte, string, int, error) {
+	return c.PutCtx(context.Background(), url, headers, body)
+}
+
+func (c *Client) PutCtx(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, string, int, error) {
+	return responseTuple(c.send(ctx, "PUT", url, headers, body))
+}
+
+func (c *Client) Patch(url string, headers map[string]string, body []byte) ([]byte, string, int, error) {
+	return c.PatchCtx(context.Background(), url, headers, body)
+}
+
+func (c *Client) PatchCtx(ctx context.Context, url string, headers map[string]string, body []byte) ([]byte, string, int, error) {
+	return responseTuple(c.send(ctx, "PATCH", url, headers, body))
+}
+
+func (c *Client) Delete(url string, headers map[string]string) ([]byte, string, int, error) {
+	return c.DeleteCtx(context.Background(), url, headers)
+}
+
+func (c *Client) DeleteCtx(ctx context.Context, url string, headers map[string]string) ([]byte, string, int, error) {
+	return responseTuple(c.send(ctx, "DELETE", url, headers, nil))
+}
+
+// Head returns an empty body, see the status and status code
+func (c *Client) Head(url string, headers map[string]string) ([]byte, string, int, error) {
+	return c.HeadCtx(context.Background(), url, headers)
+}
+
+func (c *Client) HeadCtx(ctx context.Context, url string, headers map[string]string) ([]byte, string, int, error) {
+	return responseTuple(c.send(ctx, "HEAD", url, headers, nil))
+}
+
+func (c *Client) Options(url string, headers map[string]string) ([]byte, string, int, error) {
+	return c.OptionsCtx(context.Background(), url, headers)
+}
+
+func (c *Client) OptionsCtx(ctx context.Context, url string, headers map[string]string) ([]byte, string, int, error) {
+	return responseTuple(c.send(ctx, "OPTIONS", url, headers, nil))
+}
+
+// Do builds a one shot client from transport, prefer NewClient for repeated calls
+func (l *Utils) Do(method string, url string, headers map[string]string, query map[string]string, body io.Reader, transport PHttp) ([]byte, string, int, error) {
+	return l.DoCtx(context.Background(), method, url, headers, query, body, transport)
+}
+
+// DoCtx, Do canceled when ctx is done ( see ErrRequestCanceled & ErrRequestTimeout )
+func (l *Utils) DoCtx(ctx context.Context, method string, url string, headers map[string]string, query map[string]string, body io.Reader, transport PHttp) ([]byte, string, int, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.DoCtx(ctx, method, url, headers, query, body)
+}
+
+// Request builds a one shot client from transport, prefer NewClient for repeated calls
+func (l *Utils) Request(ctx context.Context, method string, url string, headers map[string]string, query map[string]string, body io.Reader, transport PHttp) (*Response, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.Request(ctx, method, url, headers, query, body)
+}
+
+func (l *Utils) Put(url string, headers map[string]string, body []byte, transport PHttp) ([]byte, string, int, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.Put(url, headers, body)
+}
+
+func (l *Utils) Patch(url string, headers map[string]string, body []byte, transport PHttp) ([]byte, string, int, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.Patch(url, headers, body)
+}
+
+func (l *Utils) Delete(url string, headers map[string]string, transport PHttp) ([]byte, string, int, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.Delete(url, headers)
+}
+
+func (l *Utils) Head(url string, headers map[string]string, transport PHttp) ([]byte, string, int, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.Head(url, headers)
+}
+
+func (l *Utils) Options(url string, headers map[string]string, transport PHttp) ([]byte, string, int, error) {
+
+	c := l.oneShotClient(transport)
+	defer c.Close()
+
+	return c.Options(url, headers)
+}
+
+// Add query parameters to the query string of a url
+func withQuery(rawURL string, query map[string]string) (string, error) {
+
+	if len(query) == 0 {
+		return rawURL, nil
+	}
+
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	for k, v := range query {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}